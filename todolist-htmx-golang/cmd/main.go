@@ -1,6 +1,9 @@
 package main
 
 import (
+	// The alpine image has no zoneinfo, and users pick their own time zone.
+	_ "time/tzdata"
+
 	_ "github.com/lib/pq"
 
 	"github.com/deeprecession/golang-htmx-crud/pkg/app"
@@ -1,21 +1,33 @@
 package app
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"fmt"
+	"html/template"
 	"io"
 	"log/slog"
+	"math"
+	"net"
+	"net/url"
 	"os"
-	"text/template"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo-contrib/echoprometheus"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
 
 	"github.com/deeprecession/golang-htmx-crud/pkg/db"
 	"github.com/deeprecession/golang-htmx-crud/pkg/handlers"
+	"github.com/deeprecession/golang-htmx-crud/pkg/logger"
+	"github.com/deeprecession/golang-htmx-crud/pkg/mailer"
 	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+	"github.com/deeprecession/golang-htmx-crud/pkg/oidc"
 )
 
 type App struct {
@@ -37,23 +49,57 @@ func NewApp() (*App, error) {
 
 	rdb := getRedisDB(log)
 
-	templates := newTemplate()
+	hasher := getPasswordHasher(log)
 
-	server := getServer(templates, log, dbCon, rdb)
+	mail := getMailer(log)
+
+	loginLimiter := getLoginLimiter(log, rdb)
+
+	oidcProviders, loginProviders := getOIDCProviders(log, getBaseURL())
+
+	templates := newTemplate(loginProviders)
+
+	server := getServer(templates, log, dbCon, rdb, hasher, loginLimiter, mail, oidcProviders)
 
 	return &App{log: log, db: dbCon, rdb: rdb, server: server}, nil
 }
 
+// Templates renders with a fixed set of clones of the parsed templates, made
+// once at startup, so requests only execute them.
 type Templates struct {
+	renderers chan *templateRenderer
+}
+
+// templateRenderer is a clone of the parsed templates whose csrfToken func
+// returns the token of the request it is rendering.
+type templateRenderer struct {
 	templates *template.Template
+	csrfToken string
+}
+
+func newTemplate(loginProviders []handlers.LoginProvider) *Templates {
+	return newTemplates(parseTemplates("./templates/**/*.html", loginProviders), runtime.GOMAXPROCS(0))
+}
+
+func parseTemplates(pattern string, loginProviders []handlers.LoginProvider) *template.Template {
+	return template.Must(template.New("").Funcs(templateFuncs(loginProviders)).ParseGlob(pattern))
 }
 
-func newTemplate() *Templates {
-	tmpl := template.Must(template.ParseGlob("./templates/**/*.html"))
+// newTemplates clones the parsed templates once for each of size requests that
+// can render at the same time.
+func newTemplates(parsed *template.Template, size int) *Templates {
+	renderers := make(chan *templateRenderer, size)
 
-	return &Templates{
-		templates: tmpl,
+	for range size {
+		renderer := &templateRenderer{}
+		renderer.templates = template.Must(parsed.Clone()).Funcs(template.FuncMap{
+			"csrfToken": func() string { return renderer.csrfToken },
+		})
+
+		renderers <- renderer
 	}
+
+	return &Templates{renderers: renderers}
 }
 
 func getRedisDB(log *slog.Logger) *redis.Client {
@@ -88,10 +134,12 @@ func getDB(log *slog.Logger) *sql.DB {
 		os.Exit(1)
 	}
 
+	dbTarget := psqlLogAttrs(psqlInfo)
+
 	dbConnection, err := db.CreatePostgresDatabase(psqlInfo)
 
 	for err != nil {
-		log.Error("failed to connect to a database:", "psqlInfo", psqlInfo, "err", err)
+		log.Error("failed to connect to a database:", append(dbTarget, "err", err)...)
 
 		reconnectSecondsTime := 5
 		time.Sleep(time.Duration(reconnectSecondsTime) * time.Second)
@@ -99,11 +147,278 @@ func getDB(log *slog.Logger) *sql.DB {
 		dbConnection, err = db.CreatePostgresDatabase(psqlInfo)
 	}
 
-	log.Info("Connected to Postgresql", "posqlInfo", psqlInfo)
+	log.Info("Connected to Postgresql", dbTarget...)
 
 	return dbConnection
 }
 
+// psqlLogAttrs describes the database a connection string points to without
+// its credentials, which must never reach the log.
+func psqlLogAttrs(psqlInfo string) []any {
+	dbURL, err := url.Parse(psqlInfo)
+	if err != nil {
+		return []any{}
+	}
+
+	return []any{
+		"host", dbURL.Hostname(),
+		"port", dbURL.Port(),
+		"database", strings.TrimPrefix(dbURL.Path, "/"),
+	}
+}
+
+func getPasswordHasher(log *slog.Logger) models.PasswordHasher {
+	config := models.DefaultPasswordHasherConfig()
+
+	if algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm != "" {
+		config.Algorithm = algorithm
+	}
+
+	if bcryptCost := os.Getenv("PASSWORD_HASH_BCRYPT_COST"); bcryptCost != "" {
+		cost, err := strconv.Atoi(bcryptCost)
+		if err != nil {
+			log.Error("invalid PASSWORD_HASH_BCRYPT_COST", "err", err)
+
+			os.Exit(1)
+		}
+
+		config.BcryptCost = cost
+	}
+
+	config.Argon2Time = getUint32Env(log, "PASSWORD_HASH_ARGON2_TIME", config.Argon2Time)
+	config.Argon2Memory = getUint32Env(log, "PASSWORD_HASH_ARGON2_MEMORY_KB", config.Argon2Memory)
+
+	threads := getUint32Env(log, "PASSWORD_HASH_ARGON2_THREADS", uint32(config.Argon2Threads))
+	if threads > math.MaxUint8 {
+		log.Error("PASSWORD_HASH_ARGON2_THREADS is too big", "threads", threads)
+
+		os.Exit(1)
+	}
+
+	config.Argon2Threads = uint8(threads)
+
+	hasher, err := models.NewPasswordHasher(config)
+	if err != nil {
+		log.Error("failed to create a password hasher", "err", err)
+
+		os.Exit(1)
+	}
+
+	log.Info("Using password hash", "algorithm", config.Algorithm)
+
+	return hasher
+}
+
+func getMailer(log *slog.Logger) mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "todolist <no-reply@localhost>"
+	}
+
+	switch mailerType := os.Getenv("MAILER"); mailerType {
+	case "smtp":
+		log.Info("Sending mail through SMTP", "host", os.Getenv("SMTP_HOST"))
+
+		return mailer.NewSMTPMailer(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			from,
+		)
+	case "file":
+		fileMailer, err := mailer.NewFileMailer(os.Getenv("MAILER_DIR"), from, log)
+		if err != nil {
+			log.Error("failed to create a file mailer", "err", err)
+
+			os.Exit(1)
+		}
+
+		log.Info("Writing mail to files", "dir", os.Getenv("MAILER_DIR"))
+
+		return fileMailer
+	case "", "log":
+		log.Info("Writing mail to the log")
+
+		return mailer.NewLogMailer(log)
+	default:
+		log.Error("unknown MAILER", "mailer", mailerType)
+
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func getBaseURL() string {
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + os.Getenv("APP_PORT")
+	}
+
+	return strings.TrimSuffix(baseURL, "/")
+}
+
+// getOIDCProviders reads the identity providers listed in OIDC_PROVIDERS. Each
+// one is configured with OIDC_<NAME>_* variables.
+func getOIDCProviders(
+	log *slog.Logger,
+	baseURL string,
+) (map[string]handlers.OIDCProvider, []handlers.LoginProvider) {
+	providers := map[string]handlers.OIDCProvider{}
+	loginProviders := []handlers.LoginProvider{}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		envPrefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		config := oidc.ProviderConfig{
+			Name:         name,
+			DisplayName:  os.Getenv(envPrefix + "DISPLAY_NAME"),
+			IssuerURL:    os.Getenv(envPrefix + "ISSUER"),
+			ClientID:     os.Getenv(envPrefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(envPrefix + "CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/login/oidc/" + name + "/callback",
+			Scopes:       strings.Fields(os.Getenv(envPrefix + "SCOPES")),
+		}
+
+		if config.IssuerURL == "" || config.ClientID == "" {
+			log.Error("OIDC provider needs an issuer and a client id", "provider", name)
+
+			os.Exit(1)
+		}
+
+		provider, err := oidc.NewProvider(context.Background(), config)
+		if err != nil {
+			log.Error("failed to set up an OIDC provider", "provider", name, "err", err)
+
+			os.Exit(1)
+		}
+
+		log.Info("Using OIDC provider", "provider", name, "issuer", config.IssuerURL)
+
+		providers[name] = provider
+		loginProviders = append(loginProviders, handlers.LoginProvider{
+			Name:        name,
+			DisplayName: provider.DisplayName(),
+		})
+	}
+
+	return providers, loginProviders
+}
+
+func getLoginLimiter(log *slog.Logger, rdb redis.UniversalClient) models.LoginLimiter {
+	config := models.DefaultLoginLimiterConfig()
+
+	config.MaxAttemptsPerLogin = getIntEnv(log, "LOGIN_MAX_ATTEMPTS_PER_LOGIN", config.MaxAttemptsPerLogin)
+	config.MaxAttemptsPerIP = getIntEnv(log, "LOGIN_MAX_ATTEMPTS_PER_IP", config.MaxAttemptsPerIP)
+	config.AttemptsWindow = getDurationEnv(log, "LOGIN_ATTEMPTS_WINDOW", config.AttemptsWindow)
+	config.BaseLockout = getDurationEnv(log, "LOGIN_LOCKOUT_BASE", config.BaseLockout)
+	config.MaxLockout = getDurationEnv(log, "LOGIN_LOCKOUT_MAX", config.MaxLockout)
+
+	lockouts := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "myapp",
+		Name:      "login_lockouts_total",
+		Help:      "Number of temporary login lockouts caused by failed attempts.",
+	}, []string{"scope"})
+
+	prometheus.MustRegister(lockouts)
+
+	return models.NewLoginLimiter(rdb, config, lockouts)
+}
+
+// getIPExtractor reads client IPs from X-Forwarded-For, trusting it only when
+// the request comes from one of the proxies in TRUSTED_PROXIES, so clients
+// can't choose the IP their failed logins are counted against.
+func getIPExtractor(log *slog.Logger) echo.IPExtractor {
+	ipExtractor, err := newIPExtractor(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Error("invalid env variable", "key", "TRUSTED_PROXIES", "err", err)
+
+		os.Exit(1)
+	}
+
+	return ipExtractor
+}
+
+// newIPExtractor trusts only the comma separated CIDR ranges in
+// trustedProxies. Without any, the address of the connection is used.
+func newIPExtractor(trustedProxies string) (echo.IPExtractor, error) {
+	trustOptions := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+
+	for _, cidr := range strings.Split(trustedProxies, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy range %q: %w", cidr, err)
+		}
+
+		trustOptions = append(trustOptions, echo.TrustIPRange(ipRange))
+	}
+
+	return echo.ExtractIPFromXFFHeader(trustOptions...), nil
+}
+
+func getIntEnv(log *slog.Logger, key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Error("invalid env variable", "key", key, "err", err)
+
+		os.Exit(1)
+	}
+
+	return parsed
+}
+
+func getDurationEnv(log *slog.Logger, key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Error("invalid env variable", "key", key, "err", err)
+
+		os.Exit(1)
+	}
+
+	return parsed
+}
+
+func getUint32Env(log *slog.Logger, key string, fallback uint32) uint32 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		log.Error("invalid env variable", "key", key, "err", err)
+
+		os.Exit(1)
+	}
+
+	return uint32(parsed)
+}
+
 func getLogger() *slog.Logger {
 	slogHandlerOptions := slog.HandlerOptions{
 		Level: slog.LevelDebug,
@@ -111,11 +426,45 @@ func getLogger() *slog.Logger {
 
 	stdoutTextHandler := slog.NewTextHandler(os.Stdout, &slogHandlerOptions)
 
-	return slog.New(stdoutTextHandler)
+	sensitiveKeys := logger.DefaultSensitiveKeys()
+	if extraKeys := os.Getenv("LOG_REDACT_KEYS"); extraKeys != "" {
+		sensitiveKeys = append(sensitiveKeys, strings.Split(extraKeys, ",")...)
+	}
+
+	redactingHandler := logger.NewRedactingHandler(stdoutTextHandler, sensitiveKeys)
+
+	return slog.New(redactingHandler)
 }
 
-func (t *Templates) Render(w io.Writer, name string, data interface{}, _ echo.Context) error {
-	return t.templates.ExecuteTemplate(w, name, data)
+// Render executes one of the clones made at startup with the csrf token of the
+// request. The page is buffered so the clone is free again before it is sent
+// to a slow client.
+func (t *Templates) Render(w io.Writer, name string, data interface{}, ctx echo.Context) error {
+	csrfToken := ""
+	if ctx != nil {
+		csrfToken = handlers.CSRFToken(ctx)
+	}
+
+	renderer := <-t.renderers
+	renderer.csrfToken = csrfToken
+
+	var page bytes.Buffer
+
+	err := renderer.templates.ExecuteTemplate(&page, name, data)
+
+	renderer.csrfToken = ""
+	t.renderers <- renderer
+
+	if err != nil {
+		return fmt.Errorf("failed to render %s: %w", name, err)
+	}
+
+	_, err = page.WriteTo(w)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return nil
 }
 
 func getServer(
@@ -123,13 +472,25 @@ func getServer(
 	log *slog.Logger,
 	dbCon *sql.DB,
 	rdb redis.UniversalClient,
+	hasher models.PasswordHasher,
+	loginLimiter models.LoginLimiter,
+	mail mailer.Mailer,
+	oidcProviders map[string]handlers.OIDCProvider,
 ) *echo.Echo {
 	server := echo.New()
 	server.Renderer = templates
+	server.IPExtractor = getIPExtractor(log)
 
 	server.Use(handlers.NewLoggerMiddleware(log))
 
-	userStorage := models.GetUserStorage(log, dbCon)
+	userStorage := models.GetUserStorage(log, dbCon, hasher)
+
+	baseURL := getBaseURL()
+
+	totpIssuer := os.Getenv("TOTP_ISSUER")
+	if totpIssuer == "" {
+		totpIssuer = "todolist-htmx-golang"
+	}
 	sessionStorage := models.NewSessionStore(rdb)
 
 	baseGroup := server.Group("")
@@ -139,28 +500,179 @@ func getServer(
 	baseGroup.Use(echoprometheus.NewMiddleware("myapp"))
 	baseGroup.GET("/metrics", echoprometheus.NewHandler())
 
+	baseGroup.Use(handlers.CSRFMiddleware(&sessionStorage, log))
+
 	authRequiredBaseGroup := baseGroup.Group("")
-	authRequiredBaseGroup.Use(handlers.AuthorizationCheckMiddleware(&sessionStorage, log))
+	authRequiredBaseGroup.Use(
+		handlers.AuthorizationCheckMiddleware(&sessionStorage, &userStorage, log),
+	)
+
+	authRequiredBaseGroup.GET("/", handlers.BaseHandler(&userStorage, log))
+	authRequiredBaseGroup.GET("/task/:id", handlers.GetTaskHandler(&userStorage, log))
+	authRequiredBaseGroup.GET("/task/:id/edit", handlers.EditTaskHandler(&userStorage, log))
+	authRequiredBaseGroup.PUT("/task/:id", handlers.ToggleDoneStatusTaskHandler(&userStorage, log))
+	authRequiredBaseGroup.PATCH("/task/:id", handlers.UpdateTaskHandler(&userStorage, log))
+	authRequiredBaseGroup.DELETE("/task/:id", handlers.RemoveTaskHandler(&userStorage, log))
+	authRequiredBaseGroup.POST("/tasks", handlers.CreateTaskHandler(&userStorage, log))
+	authRequiredBaseGroup.GET("/task/:id/description", handlers.TaskDescriptionHandler(&userStorage, log))
+	authRequiredBaseGroup.GET("/task/:id/description/edit",
+		handlers.EditTaskDescriptionHandler(&userStorage, log))
+	authRequiredBaseGroup.PUT("/task/:id/description",
+		handlers.UpdateTaskDescriptionHandler(&userStorage, log))
+	authRequiredBaseGroup.POST("/tasks/preview", handlers.PreviewMarkdownHandler(log))
+	authRequiredBaseGroup.DELETE("/task/:id/tags/:tag_id", handlers.RemoveTaskTagHandler(&userStorage, log))
+	authRequiredBaseGroup.POST("/task/:id/subtasks", handlers.CreateSubtaskHandler(&userStorage, log))
+	authRequiredBaseGroup.PUT("/task/:id/subtasks/:subtask_id", handlers.ToggleSubtaskHandler(&userStorage, log))
+	authRequiredBaseGroup.DELETE("/task/:id/subtasks/:subtask_id", handlers.RemoveSubtaskHandler(&userStorage, log))
+	authRequiredBaseGroup.GET("/tags", handlers.TagsPageHandler(&userStorage, log))
+	authRequiredBaseGroup.POST("/tags", handlers.CreateTagHandler(&userStorage, log))
+	authRequiredBaseGroup.PATCH("/tags/:id", handlers.UpdateTagHandler(&userStorage, log))
+	authRequiredBaseGroup.DELETE("/tags/:id", handlers.DeleteTagHandler(&userStorage, log))
+	authRequiredBaseGroup.GET("/lists/:id", handlers.ListHandler(&userStorage, log))
+	authRequiredBaseGroup.POST("/lists", handlers.CreateListHandler(&userStorage, log))
+	authRequiredBaseGroup.PATCH("/lists/:id", handlers.UpdateListHandler(&userStorage, log))
+	authRequiredBaseGroup.DELETE("/lists/:id", handlers.DeleteListHandler(&userStorage, log))
+	authRequiredBaseGroup.DELETE("/lists/:id/members/:user_id", handlers.RemoveListMemberHandler(&userStorage, log))
+
+	verifiedEmailGroup := authRequiredBaseGroup.Group("")
+	verifiedEmailGroup.Use(handlers.RequireVerifiedEmail(&userStorage, log))
+
+	verifiedEmailGroup.POST("/lists/:id/members", handlers.ShareListHandler(&userStorage, log))
+
+	sessionRequiredGroup := authRequiredBaseGroup.Group("")
+	sessionRequiredGroup.Use(handlers.RequireSessionMiddleware(log))
+
+	sessionRequiredGroup.GET(
+		"/settings",
+		handlers.SettingsPageHandler(&sessionStorage, &userStorage, log),
+	)
+	sessionRequiredGroup.POST(
+		"/settings/password",
+		handlers.ChangePasswordHandler(&sessionStorage, &userStorage, log),
+	)
+	sessionRequiredGroup.POST(
+		"/settings/timezone",
+		handlers.ChangeTimeZoneHandler(&sessionStorage, &userStorage, &userStorage, log),
+	)
+	sessionRequiredGroup.POST(
+		"/settings/tasks",
+		handlers.ChangeTaskSettingsHandler(&sessionStorage, &userStorage, &userStorage, log),
+	)
+	sessionRequiredGroup.GET(
+		"/sessions",
+		handlers.SessionsPageHandler(&sessionStorage, &userStorage, log),
+	)
+	sessionRequiredGroup.DELETE("/sessions/:id", handlers.RevokeSessionHandler(&sessionStorage, log))
+	sessionRequiredGroup.POST("/logout/all", handlers.LogoutEverywhereHandler(&sessionStorage, log))
 
-	authRequiredBaseGroup.GET("/", handlers.BaseHandler(&sessionStorage, &userStorage, log))
-	authRequiredBaseGroup.PUT(
-		"/task/:id",
-		handlers.ToggleDoneStatusTaskHandler(&sessionStorage, &userStorage, log),
+	sessionRequiredGroup.GET(
+		"/settings/tokens",
+		handlers.APITokensPageHandler(&sessionStorage, &userStorage, &userStorage, log),
 	)
-	authRequiredBaseGroup.DELETE(
-		"/task/:id",
-		handlers.RemoveTaskHandler(&sessionStorage, &userStorage, log),
+	sessionRequiredGroup.POST(
+		"/settings/tokens",
+		handlers.CreateAPITokenHandler(&sessionStorage, &userStorage, &userStorage, log),
 	)
-	authRequiredBaseGroup.POST(
-		"/tasks",
-		handlers.CreateTaskHandler(&sessionStorage, &userStorage, log),
+	sessionRequiredGroup.DELETE(
+		"/settings/tokens/:id",
+		handlers.RevokeAPITokenHandler(&sessionStorage, &userStorage, log),
 	)
 
+	sessionRequiredGroup.POST(
+		"/settings/email",
+		handlers.ChangeEmailHandler(&sessionStorage, &userStorage, &userStorage, mail, baseURL, log),
+	)
+	sessionRequiredGroup.POST(
+		"/settings/email/verify",
+		handlers.ResendVerificationHandler(
+			&sessionStorage,
+			&userStorage,
+			&userStorage,
+			mail,
+			baseURL,
+			log,
+		),
+	)
+	sessionRequiredGroup.GET(
+		"/settings/identities",
+		handlers.IdentitiesHandler(&sessionStorage, &userStorage, log),
+	)
+	sessionRequiredGroup.POST(
+		"/settings/identities/:provider",
+		handlers.LinkIdentityHandler(&sessionStorage, &sessionStorage, oidcProviders, log),
+	)
+	sessionRequiredGroup.POST(
+		"/settings/2fa/setup",
+		handlers.TwoFactorSetupHandler(&sessionStorage, &userStorage, &userStorage, totpIssuer, log),
+	)
+	sessionRequiredGroup.POST(
+		"/settings/2fa/enable",
+		handlers.EnableTwoFactorHandler(&sessionStorage, &userStorage, log),
+	)
+	sessionRequiredGroup.POST(
+		"/settings/2fa/disable",
+		handlers.DisableTwoFactorHandler(&sessionStorage, &userStorage, &userStorage, log),
+	)
+
+	apiGroup := baseGroup.Group("/api/v1")
+	apiGroup.Use(handlers.AuthorizationCheckMiddleware(&sessionStorage, &userStorage, log))
+
+	apiGroup.GET("/user", handlers.APICurrentUserHandler(&userStorage, log))
+	apiGroup.GET("/tasks", handlers.APIListTasksHandler(&userStorage, log))
+	apiGroup.POST("/tasks", handlers.APICreateTaskHandler(&userStorage, log))
+	apiGroup.GET("/tasks/:id", handlers.APIGetTaskHandler(&userStorage, log))
+	apiGroup.PUT("/tasks/:id", handlers.APIUpdateTaskHandler(&userStorage, false, log))
+	apiGroup.PATCH("/tasks/:id", handlers.APIUpdateTaskHandler(&userStorage, true, log))
+	apiGroup.DELETE("/tasks/:id", handlers.APIDeleteTaskHandler(&userStorage, log))
+
+	openAPIDocument := newOpenAPIDocument()
+
+	baseGroup.GET("/api/openapi.json", handlers.OpenAPIHandler(openAPIDocument))
+	baseGroup.GET("/api/docs", handlers.APIDocsHandler(log))
+
+	baseGroup.POST("/logout", handlers.LogoutHandler(&sessionStorage, log))
+
+	baseGroup.GET("/forgot-password", handlers.ForgotPasswordPageHandler(log))
+	baseGroup.POST(
+		"/forgot-password",
+		handlers.ForgotPasswordHandler(&userStorage, mail, baseURL, log),
+	)
+	baseGroup.GET("/reset-password", handlers.ResetPasswordPageHandler(&userStorage, log))
+	baseGroup.POST("/reset-password", handlers.ResetPasswordHandler(&sessionStorage, &userStorage, log))
+
 	baseGroup.GET("/register", handlers.RegisterPageHandler(log))
-	baseGroup.POST("/register", handlers.RegisterUserHandler(&userStorage, log))
+	baseGroup.POST(
+		"/register",
+		handlers.RegisterUserHandler(&userStorage, &userStorage, mail, baseURL, log),
+	)
+	baseGroup.GET("/verify-email", handlers.VerifyEmailHandler(&userStorage, log))
 
 	baseGroup.GET("/login", handlers.LoginPageHandler(log))
-	baseGroup.POST("/login", handlers.LoginUserHandler(&sessionStorage, &userStorage, log))
+	baseGroup.POST("/login", handlers.LoginUserHandler(&sessionStorage, &userStorage, &loginLimiter, log))
+	baseGroup.GET(
+		"/login/oidc/:provider",
+		handlers.OIDCLoginHandler(&sessionStorage, oidcProviders, log),
+	)
+	baseGroup.GET(
+		"/login/oidc/:provider/callback",
+		handlers.OIDCCallbackHandler(
+			&sessionStorage,
+			&sessionStorage,
+			&userStorage,
+			oidcProviders,
+			log,
+		),
+	)
+	baseGroup.POST(
+		"/login/2fa",
+		handlers.LoginSecondFactorHandler(
+			&sessionStorage,
+			&userStorage,
+			&userStorage,
+			&loginLimiter,
+			log,
+		),
+	)
 
 	return server
 }
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/logger"
+	"github.com/deeprecession/golang-htmx-crud/pkg/mailer"
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// TestOpenAPIDocumentMatchesRoutes keeps the OpenAPI document from drifting
+// away from the routes that getServer registers.
+func TestOpenAPIDocumentMatchesRoutes(t *testing.T) {
+	log := discardLogger()
+
+	server := getServer(
+		&Templates{},
+		log,
+		nil,
+		nil,
+		models.PasswordHasher{},
+		models.LoginLimiter{},
+		mailer.NewLogMailer(log),
+		nil,
+	)
+
+	undocumented, stale := newOpenAPIDocument().Diff(server.Routes())
+
+	for _, route := range undocumented {
+		t.Errorf("route %s has no entry in the OpenAPI document", route)
+	}
+
+	for _, route := range stale {
+		t.Errorf("OpenAPI document describes %s, which is not a route", route)
+	}
+}
+
+func TestPsqlLogAttrsLeaveOutCredentials(t *testing.T) {
+	const password = "db-p4ssw0rd"
+
+	var buffer bytes.Buffer
+
+	textHandler := slog.NewTextHandler(&buffer, nil)
+	log := slog.New(logger.NewRedactingHandler(textHandler, logger.DefaultSensitiveKeys()))
+
+	log.Info("Connected to Postgresql",
+		psqlLogAttrs("postgres://todo:"+password+"@db:5432/todolist?sslmode=disable")...)
+
+	output := buffer.String()
+
+	if strings.Contains(output, password) || strings.Contains(output, "todo:") {
+		t.Errorf("database credentials reached the log: %s", output)
+	}
+
+	for _, want := range []string{"host=db", "port=5432", "database=todolist"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("log is missing %q: %s", want, output)
+		}
+	}
+}
+
+func TestIPExtractorIgnoresSpoofedHeaders(t *testing.T) {
+	const (
+		clientIP  = "198.51.100.7"
+		spoofedIP = "203.0.113.66"
+	)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "direct client spoofing X-Forwarded-For",
+			remoteAddr: clientIP + ":51000",
+			headers:    map[string]string{echo.HeaderXForwardedFor: spoofedIP},
+			want:       clientIP,
+		},
+		{
+			name:       "direct client spoofing X-Real-IP",
+			remoteAddr: clientIP + ":51000",
+			headers:    map[string]string{echo.HeaderXRealIP: spoofedIP},
+			want:       clientIP,
+		},
+		{
+			name:       "private address that isn't a trusted proxy",
+			remoteAddr: "192.168.1.20:51000",
+			headers:    map[string]string{echo.HeaderXForwardedFor: spoofedIP},
+			want:       "192.168.1.20",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "172.18.0.5:51000",
+			headers:    map[string]string{echo.HeaderXForwardedFor: clientIP},
+			want:       clientIP,
+		},
+		{
+			name:       "client spoofing through a trusted proxy",
+			remoteAddr: "172.18.0.5:51000",
+			headers:    map[string]string{echo.HeaderXForwardedFor: spoofedIP + ", " + clientIP},
+			want:       clientIP,
+		},
+	}
+
+	ipExtractor, err := newIPExtractor("172.18.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := echo.New()
+			server.IPExtractor = ipExtractor
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = test.remoteAddr
+
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+
+			got := server.NewContext(request, httptest.NewRecorder()).RealIP()
+			if got != test.want {
+				t.Errorf("RealIP() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewIPExtractorRejectsInvalidRanges(t *testing.T) {
+	_, err := newIPExtractor("10.0.0.0/8, nginx")
+	if err == nil {
+		t.Error("expected an error for an invalid proxy range")
+	}
+}
@@ -0,0 +1,400 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/handlers"
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+	"github.com/deeprecession/golang-htmx-crud/pkg/openapi"
+)
+
+const (
+	tagAPI      = "api"
+	tagTasks    = "tasks"
+	tagAccount  = "account"
+	tagSettings = "settings"
+	tagService  = "service"
+)
+
+var (
+	sessionSecurity = []map[string][]string{{"sessionCookie": {}}}
+	taskSecurity    = []map[string][]string{{"sessionCookie": {}}, {"bearerAuth": {}}}
+
+	taskListParameters = []openapi.Parameter{
+		{
+			Name: "view",
+			In:   "query",
+			Schema: &openapi.Schema{Type: "string", Enum: []string{
+				string(models.TaskViewToday),
+				string(models.TaskViewUpcoming),
+				string(models.TaskViewNoDate),
+			}},
+		},
+		{
+			Name: "order",
+			In:   "query",
+			Schema: &openapi.Schema{Type: "string", Enum: []string{
+				string(models.TaskOrderCreated),
+				string(models.TaskOrderDue),
+			}},
+		},
+		{
+			Name:   "tag",
+			In:     "query",
+			Schema: &openapi.Schema{Type: "string"},
+		},
+	}
+)
+
+// newOpenAPIDocument describes every route of getServer.
+// TestOpenAPIDocumentMatchesRoutes fails when the two disagree, so a new route
+// needs an entry here.
+func newOpenAPIDocument() *openapi.Document {
+	document := openapi.NewDocument(openapi.Info{
+		Title:   "todolist-htmx-golang",
+		Version: "1.0.0",
+		Description: "HTML pages and htmx fragments for the browser, and a JSON API under /api/v1. " +
+			"Writes with a session cookie need the X-CSRF-Token header or the csrf_token form field.",
+	})
+
+	document.Components.SecuritySchemes["sessionCookie"] = openapi.SecurityScheme{
+		Type: "apiKey",
+		In:   "cookie",
+		Name: "session",
+	}
+	document.Components.SecuritySchemes["bearerAuth"] = openapi.SecurityScheme{
+		Type:   "http",
+		Scheme: "bearer",
+	}
+
+	task := document.SchemaRef("Task", models.Task{})
+	user := document.SchemaRef("User", models.User{})
+	taskList := document.SchemaRef("TaskList", handlers.APITaskListResponse{})
+	taskRequest := document.SchemaRef("TaskRequest", handlers.APITaskRequest{})
+	problem := document.SchemaRef("Problem", handlers.ProblemDetails{})
+
+	addAPIRoutes(document, task, user, taskList, taskRequest, problem)
+	addTaskRoutes(document, task, taskList, taskRequest, problem)
+	addAccountRoutes(document)
+	addSettingsRoutes(document)
+	addServiceRoutes(document)
+
+	return document
+}
+
+func htmlOperation(summary, tag string, formFields ...string) openapi.Operation {
+	operation := openapi.Operation{
+		Summary: summary,
+		Tags:    []string{tag},
+		Responses: map[string]openapi.Response{
+			"200": openapi.HTMLResponse("Page or htmx fragment"),
+		},
+	}
+
+	if len(formFields) != 0 {
+		operation.RequestBody = openapi.FormBody(formFields...)
+	}
+
+	return operation
+}
+
+func redirectOperation(summary, tag string, formFields ...string) openapi.Operation {
+	operation := htmlOperation(summary, tag, formFields...)
+	operation.Responses["302"] = openapi.Response{Description: "Redirect"}
+
+	return operation
+}
+
+// requiresVerifiedEmail documents the 403 of routes behind
+// handlers.RequireVerifiedEmail.
+func requiresVerifiedEmail(operation openapi.Operation) openapi.Operation {
+	operation.Responses["403"] = openapi.Response{Description: "Email address is not verified"}
+
+	return operation
+}
+
+func problemResponse(description string, problem *openapi.Schema) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{handlers.MIMEApplicationProblemJSON: {Schema: problem}},
+	}
+}
+
+func withSecurity(
+	operation openapi.Operation,
+	security []map[string][]string,
+) openapi.Operation {
+	operation.Security = security
+
+	return operation
+}
+
+func addAPIRoutes(document *openapi.Document, task, user, taskList, taskRequest, problem *openapi.Schema) {
+	errorResponses := func(responses map[string]openapi.Response, statuses ...string) map[string]openapi.Response {
+		descriptions := map[string]string{
+			"400": "Malformed request",
+			"401": "Not authenticated",
+			"403": "Missing scope or CSRF token, or the task is read-only",
+			"404": "Task is not found",
+			"422": "Invalid task",
+		}
+
+		for _, status := range append([]string{"401", "403"}, statuses...) {
+			responses[status] = problemResponse(descriptions[status], problem)
+		}
+
+		return responses
+	}
+
+	apiOperation := func(summary string, responses map[string]openapi.Response) openapi.Operation {
+		return openapi.Operation{
+			Summary:   summary,
+			Tags:      []string{tagAPI},
+			Responses: responses,
+			Security:  taskSecurity,
+		}
+	}
+
+	document.Add(http.MethodGet, "/api/v1/user", apiOperation("Get the current user",
+		errorResponses(map[string]openapi.Response{"200": openapi.JSONResponse("Current user", user)})))
+
+	listTasks := apiOperation("List tasks", errorResponses(
+		map[string]openapi.Response{"200": openapi.JSONResponse("Tasks", taskList)},
+		"400",
+	))
+	listTasks.Parameters = append([]openapi.Parameter{{
+		Name:   "list",
+		In:     "query",
+		Schema: &openapi.Schema{Type: "string"},
+	}}, taskListParameters...)
+	document.Add(http.MethodGet, "/api/v1/tasks", listTasks)
+
+	createTask := apiOperation("Create a task", errorResponses(
+		map[string]openapi.Response{"201": openapi.JSONResponse("Created task", task)},
+		"400", "422",
+	))
+	createTask.RequestBody = openapi.JSONBody(taskRequest)
+	document.Add(http.MethodPost, "/api/v1/tasks", createTask)
+
+	document.Add(http.MethodGet, "/api/v1/tasks/:id", apiOperation("Get a task", errorResponses(
+		map[string]openapi.Response{"200": openapi.JSONResponse("Task", task)},
+		"400", "404",
+	)))
+
+	replaceTask := apiOperation("Replace a task", errorResponses(
+		map[string]openapi.Response{"200": openapi.JSONResponse("Updated task", task)},
+		"400", "404", "422",
+	))
+	replaceTask.RequestBody = openapi.JSONBody(taskRequest)
+	document.Add(http.MethodPut, "/api/v1/tasks/:id", replaceTask)
+
+	patchTask := apiOperation("Update some fields of a task", errorResponses(
+		map[string]openapi.Response{"200": openapi.JSONResponse("Updated task", task)},
+		"400", "404", "422",
+	))
+	patchTask.RequestBody = openapi.JSONBody(taskRequest)
+	document.Add(http.MethodPatch, "/api/v1/tasks/:id", patchTask)
+
+	document.Add(http.MethodDelete, "/api/v1/tasks/:id", apiOperation("Delete a task", errorResponses(
+		map[string]openapi.Response{"204": {Description: "Task is deleted"}},
+		"400", "404",
+	)))
+}
+
+// addTaskRoutes documents the task routes, which answer with HTML or, when the
+// Accept header prefers it, with JSON and problem documents.
+func addTaskRoutes(document *openapi.Document, task, taskList, taskRequest, problem *openapi.Schema) {
+	negotiated := func(
+		operation openapi.Operation,
+		status string,
+		schema *openapi.Schema,
+		problemStatuses ...string,
+	) openapi.Operation {
+		descriptions := map[string]string{
+			"400": "Malformed request",
+			"401": "Not authenticated",
+			"403": "Task or list is read-only",
+			"404": "Task is not found",
+			"422": "Invalid task",
+		}
+
+		response := operation.Responses[status]
+		if response.Content == nil {
+			response.Content = map[string]openapi.MediaType{}
+		}
+
+		if schema != nil {
+			response.Content[echo.MIMEApplicationJSON] = openapi.MediaType{Schema: schema}
+		}
+
+		operation.Responses[status] = response
+
+		for _, problemStatus := range append([]string{"401"}, problemStatuses...) {
+			operation.Responses[problemStatus] = problemResponse(descriptions[problemStatus], problem)
+		}
+
+		operation.Security = taskSecurity
+
+		return operation
+	}
+
+	taskListPage := negotiated(redirectOperation("Task list page of the Inbox", tagTasks), "200", taskList, "400")
+	taskListPage.Parameters = taskListParameters
+	document.Add(http.MethodGet, "/", taskListPage)
+
+	listPage := negotiated(redirectOperation("Task list page of a list", tagTasks), "200", taskList, "400", "404")
+	listPage.Parameters = taskListParameters
+	document.Add(http.MethodGet, "/lists/:id", listPage)
+
+	createTask := negotiated(htmlOperation("Create a task", tagTasks, "title", "list_id"), "200", nil,
+		"400", "403", "422")
+	createTask.RequestBody.Content[echo.MIMEApplicationJSON] = openapi.MediaType{Schema: taskRequest}
+	createTask.Responses["201"] = openapi.JSONResponse("Created task", task)
+	document.Add(http.MethodPost, "/tasks", createTask)
+
+	document.Add(http.MethodGet, "/task/:id", negotiated(
+		htmlOperation("Get a task", tagTasks), "200", task, "400", "404"))
+	document.Add(http.MethodGet, "/task/:id/edit", negotiated(
+		htmlOperation("Form that edits the title of a task", tagTasks), "200", nil, "400", "403", "404"))
+
+	updateTask := negotiated(htmlOperation("Change the title of a task", tagTasks, "title"), "200", task,
+		"400", "403", "404", "422")
+	updateTask.RequestBody.Content[echo.MIMEApplicationJSON] = openapi.MediaType{Schema: taskRequest}
+	document.Add(http.MethodPatch, "/task/:id", updateTask)
+
+	document.Add(http.MethodGet, "/task/:id/description", negotiated(
+		htmlOperation("Description panel of a task", tagTasks), "200", nil, "400", "404"))
+	document.Add(http.MethodGet, "/task/:id/description/edit", negotiated(
+		htmlOperation("Form that edits the description of a task", tagTasks), "200", nil, "400", "403", "404"))
+
+	updateDescription := negotiated(htmlOperation("Change the Markdown description of a task", tagTasks,
+		"description"), "200", task, "400", "403", "404", "422")
+	updateDescription.RequestBody.Content[echo.MIMEApplicationJSON] = openapi.MediaType{Schema: taskRequest}
+	document.Add(http.MethodPut, "/task/:id/description", updateDescription)
+
+	document.Add(http.MethodPost, "/tasks/preview", withSecurity(
+		htmlOperation("Render a Markdown description without saving it", tagTasks, "description"),
+		taskSecurity))
+
+	document.Add(http.MethodPut, "/task/:id", negotiated(
+		htmlOperation("Toggle the done status of a task", tagTasks), "200", task, "400", "403", "404"))
+
+	deleteTask := negotiated(htmlOperation("Delete a task", tagTasks), "200", nil, "400", "403", "404")
+	deleteTask.Responses["204"] = openapi.Response{Description: "Task is deleted"}
+	document.Add(http.MethodDelete, "/task/:id", deleteTask)
+
+	document.Add(http.MethodDelete, "/task/:id/tags/:tag_id", negotiated(
+		htmlOperation("Take a tag off a task", tagTasks), "200", task, "400", "403", "404"))
+
+	document.Add(http.MethodPost, "/task/:id/subtasks", negotiated(
+		htmlOperation("Add an item to the checklist of a task", tagTasks, "title"), "200", task,
+		"400", "403", "404", "422"))
+	document.Add(http.MethodPut, "/task/:id/subtasks/:subtask_id", negotiated(
+		htmlOperation("Toggle the done status of a checklist item", tagTasks), "200", task, "400", "403", "404"))
+	document.Add(http.MethodDelete, "/task/:id/subtasks/:subtask_id", negotiated(
+		htmlOperation("Delete an item from the checklist of a task", tagTasks), "200", task, "400", "403", "404"))
+
+	for _, route := range []struct {
+		method    string
+		path      string
+		operation openapi.Operation
+	}{
+		{http.MethodGet, "/tags", htmlOperation("Tags page", tagTasks)},
+		{http.MethodPost, "/tags", htmlOperation("Create a tag", tagTasks, "name")},
+		{http.MethodPatch, "/tags/:id", htmlOperation("Rename or recolor a tag", tagTasks, "name", "color")},
+		{http.MethodDelete, "/tags/:id", htmlOperation("Delete a tag and take it off every task", tagTasks)},
+		{http.MethodPost, "/lists", htmlOperation("Create a list", tagTasks, "name")},
+		{http.MethodPatch, "/lists/:id", htmlOperation("Rename, archive or restore a list", tagTasks,
+			"name", "archived")},
+		{http.MethodDelete, "/lists/:id", htmlOperation("Delete a list with its tasks", tagTasks)},
+		{http.MethodPost, "/lists/:id/members", requiresVerifiedEmail(htmlOperation(
+			"Share a list or change the role of a member", tagTasks, "login", "role"))},
+		{http.MethodDelete, "/lists/:id/members/:user_id", htmlOperation("Remove a member from a list or leave it",
+			tagTasks)},
+	} {
+		document.Add(route.method, route.path, withSecurity(route.operation, taskSecurity))
+	}
+}
+
+func addAccountRoutes(document *openapi.Document) {
+	document.Add(http.MethodGet, "/login", htmlOperation("Login page", tagAccount))
+	document.Add(http.MethodPost, "/login",
+		redirectOperation("Log in with a password", tagAccount, "login", "password"))
+	document.Add(http.MethodPost, "/login/2fa",
+		htmlOperation("Check the second factor of a login", tagAccount, "code"))
+	document.Add(http.MethodGet, "/login/oidc/:provider",
+		redirectOperation("Log in with an OpenID Connect provider", tagAccount))
+	document.Add(http.MethodGet, "/login/oidc/:provider/callback",
+		redirectOperation("Finish an OpenID Connect login", tagAccount))
+	document.Add(http.MethodPost, "/logout", redirectOperation("End the current session", tagAccount))
+
+	document.Add(http.MethodGet, "/register", htmlOperation("Registration page", tagAccount))
+	document.Add(http.MethodPost, "/register",
+		redirectOperation("Register a user", tagAccount, "login", "email", "password"))
+	document.Add(http.MethodGet, "/verify-email", htmlOperation("Verify an email address", tagAccount))
+
+	document.Add(http.MethodGet, "/forgot-password", htmlOperation("Forgot password page", tagAccount))
+	document.Add(http.MethodPost, "/forgot-password",
+		htmlOperation("Send a password reset link", tagAccount, "login"))
+	document.Add(http.MethodGet, "/reset-password", htmlOperation("Reset password page", tagAccount))
+	document.Add(http.MethodPost, "/reset-password",
+		htmlOperation("Set a new password from a reset link", tagAccount, "token", "password"))
+}
+
+func addSettingsRoutes(document *openapi.Document) {
+	operations := []struct {
+		method    string
+		path      string
+		operation openapi.Operation
+	}{
+		{http.MethodGet, "/settings", redirectOperation("Settings page", tagSettings)},
+		{http.MethodPost, "/settings/password", htmlOperation("Change the password", tagSettings,
+			"old_password", "new_password", "confirm_password")},
+		{http.MethodPost, "/settings/email", htmlOperation("Change the email address", tagSettings, "email")},
+		{http.MethodPost, "/settings/timezone", htmlOperation("Change the time zone of due dates", tagSettings,
+			"time_zone")},
+		{http.MethodPost, "/settings/tasks", htmlOperation("Turn on or off completing tasks with their checklist",
+			tagSettings, "auto_complete")},
+		{http.MethodPost, "/settings/email/verify", htmlOperation("Resend the verification link", tagSettings)},
+		{http.MethodPost, "/settings/2fa/setup", htmlOperation("Start setting up TOTP", tagSettings)},
+		{http.MethodPost, "/settings/2fa/enable", htmlOperation("Enable TOTP", tagSettings, "code")},
+		{http.MethodPost, "/settings/2fa/disable", htmlOperation("Disable TOTP", tagSettings, "code")},
+		{http.MethodGet, "/settings/identities", htmlOperation("Linked provider accounts", tagSettings)},
+		{http.MethodPost, "/settings/identities/:provider",
+			redirectOperation("Link a provider account", tagSettings)},
+		{http.MethodGet, "/settings/tokens", htmlOperation("API tokens page", tagSettings)},
+		{http.MethodPost, "/settings/tokens", htmlOperation("Create an API token", tagSettings,
+			"name", "scope_read", "scope_write", "expires_in_days")},
+		{http.MethodDelete, "/settings/tokens/:id", htmlOperation("Revoke an API token", tagSettings)},
+		{http.MethodGet, "/sessions", htmlOperation("Active sessions page", tagSettings)},
+		{http.MethodDelete, "/sessions/:id", htmlOperation("Revoke a session", tagSettings)},
+		{http.MethodPost, "/logout/all", redirectOperation("Sign out everywhere", tagSettings)},
+	}
+
+	for _, route := range operations {
+		document.Add(route.method, route.path, withSecurity(route.operation, sessionSecurity))
+	}
+}
+
+func addServiceRoutes(document *openapi.Document) {
+	document.Add(http.MethodGet, "/assets*", openapi.Operation{
+		Summary:   "Static files",
+		Tags:      []string{tagService},
+		Responses: map[string]openapi.Response{"200": {Description: "File"}},
+	})
+	document.Add(http.MethodGet, "/metrics", openapi.Operation{
+		Summary:   "Prometheus metrics",
+		Tags:      []string{tagService},
+		Responses: map[string]openapi.Response{"200": {Description: "Metrics in the Prometheus text format"}},
+	})
+	document.Add(http.MethodGet, "/api/openapi.json", openapi.Operation{
+		Summary: "This document",
+		Tags:    []string{tagService},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("OpenAPI document", &openapi.Schema{Type: "object"}),
+		},
+	})
+	document.Add(http.MethodGet, "/api/docs", htmlOperation("API documentation", tagService))
+}
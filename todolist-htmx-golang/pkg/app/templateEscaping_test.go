@@ -0,0 +1,206 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/handlers"
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+var xssPayloads = []string{
+	`<script>alert(1)</script>`,
+	`"onmouseover="alert(1)`,
+	`'onmouseover='alert(1)`,
+}
+
+// xssText puts every payload in one value, so each field of the data is
+// checked against all of them.
+func xssText() string {
+	return "x" + strings.Join(xssPayloads, " ")
+}
+
+func xssForm() models.FormData {
+	form := models.NewFormData()
+
+	for _, field := range []string{
+		"Code", "Color", "ConfirmPassword", "Description", "DueAt", "Email", "ExpiresIn", "ListID", "ListId",
+		"Login", "Message", "Name", "NewPassword", "OldPassword", "Priority", "Role", "Scopes", "Tags",
+		"TimeZone", "Title",
+	} {
+		form.Values[field] = xssText()
+		form.Errors[field] = xssText()
+	}
+
+	return form
+}
+
+func xssTemplateData() map[string]any {
+	now := time.Now()
+	listID := 1
+	payload := xssText()
+
+	user := models.User{ID: 1, Login: payload, Email: payload, TimeZone: payload, EmailVerified: true}
+	tag := models.Tag{ID: 1, Name: payload, Color: payload}
+	list := models.List{ID: 1, Name: payload, Owner: payload, OwnerID: 1, Role: models.ListRoleOwner}
+	sharedList := models.List{ID: 2, Name: payload, Owner: payload, OwnerID: 2, Role: models.ListRoleEditor}
+	member := models.ListMember{UserID: 2, Login: payload, Role: models.ListRoleEditor}
+	task := models.Task{
+		ID:          1,
+		Title:       payload,
+		Description: payload,
+		DueAt:       &now,
+		CreatedAt:   now,
+		Tags:        []models.Tag{tag},
+		ListID:      &listID,
+		CanEdit:     true,
+		Subtasks:    []models.Subtask{{ID: 1, Title: payload}},
+	}
+
+	page := models.NewPage(models.Tasks{task}, user)
+	page.Form = xssForm()
+	page.ListForm = xssForm()
+	page.Tag = payload
+	page.List = &list
+	page.Lists = []models.List{list, sharedList}
+	page.Members = []models.ListMember{member}
+
+	taskForm := models.NewTaskForm(task)
+	taskForm.Form = xssForm()
+	taskForm.Lists = page.Lists
+
+	subtasksForm := models.NewSubtasksForm(task)
+	subtasksForm.Form = xssForm()
+	subtasksForm.Open = true
+
+	settingsPage := models.NewSettingsPage(user)
+	settingsPage.PasswordForm = xssForm()
+	settingsPage.EmailForm = xssForm()
+	settingsPage.TimeZoneForm = xssForm()
+	settingsPage.TasksForm = xssForm()
+
+	sessionsPage := models.NewSessionsPage(user, []models.Session{{
+		ID: payload, CreatedAt: now, LastSeenAt: now, IP: payload, UserAgent: payload,
+	}}, payload)
+
+	tokensPage := models.NewAPITokensPage(user, []models.APIToken{{
+		ID: 1, Name: payload, Scopes: []string{payload}, CreatedAt: now, ExpiresAt: &now, LastUsedAt: &now,
+	}})
+	tokensPage.NewToken = payload
+	tokensPage.Form = xssForm()
+
+	tagsPage := models.NewTagsPage(user, []models.Tag{tag})
+	tagsPage.Form = xssForm()
+
+	tagForm := models.NewTagForm(tag)
+	tagForm.Form = xssForm()
+
+	listForm := models.NewListForm(list)
+	listForm.Form = xssForm()
+
+	membersForm := models.NewListMembersForm(list, []models.ListMember{member}, 1)
+	membersForm.Form = xssForm()
+
+	twoFactorForm := handlers.TwoFactorFormResponse{Error: payload}
+	twoFactorSetup := handlers.TwoFactorSetupResponse{Secret: payload, Form: xssForm()}
+	forgotPassword := handlers.ForgotPasswordFormResponse{LoginValue: payload}
+	resetPassword := handlers.ResetPasswordFormResponse{Token: payload, Error: payload}
+	identities := handlers.IdentitiesResponse{Identities: []models.LinkedIdentity{
+		{Provider: payload, Email: payload, CreatedAt: now},
+	}}
+	loginForm := handlers.LoginFormResponse{LoginValue: payload, Error: payload}
+	registerForm := handlers.RegisterFormResponse{LoginValue: payload, EmailValue: payload, Error: payload}
+
+	return map[string]any{
+		"api-docs-page":             nil,
+		"api-tokens":                tokensPage,
+		"api-tokens-page":           tokensPage,
+		"change-password-form":      xssForm(),
+		"create-task-form":          xssForm(),
+		"csrf-error":                nil,
+		"csrf-field":                nil,
+		"display":                   models.Tasks{task},
+		"email-settings":            settingsPage,
+		"forgot-password-form":      forgotPassword,
+		"forgot-password-page":      forgotPassword,
+		"htmx-before-swap":          nil,
+		"linked-identities":         identities,
+		"list-create-form":          xssForm(),
+		"list-header":               listForm,
+		"list-members":              membersForm,
+		"login-2fa-form":            twoFactorForm,
+		"login-2fa-page":            twoFactorForm,
+		"login-form":                loginForm,
+		"login-page":                loginForm,
+		"markdown-preview":          payload,
+		"oidc-error-page":           handlers.OIDCErrorResponse{Error: payload, BackURL: payload},
+		"oob-task":                  task,
+		"register-form":             registerForm,
+		"register-page":             registerForm,
+		"reset-password-form":       resetPassword,
+		"reset-password-page":       resetPassword,
+		"sessions-list":             sessionsPage,
+		"sessions-page":             sessionsPage,
+		"settings-page":             settingsPage,
+		"sign-out-everywhere":       settingsPage,
+		"tag":                       tagForm,
+		"tag-chip":                  tag,
+		"tags":                      tagsPage,
+		"tags-page":                 tagsPage,
+		"task":                      task,
+		"task-description":          task,
+		"task-description-form":     taskForm,
+		"task-edit-form":            taskForm,
+		"task-lists":                page,
+		"task-priority":             task,
+		"task-settings":             settingsPage,
+		"task-subtasks":             subtasksForm,
+		"task-title":                task,
+		"tasklist-page":             page,
+		"time-zone-settings":        settingsPage,
+		"two-factor-disable-form":   xssForm(),
+		"two-factor-enable-form":    xssForm(),
+		"two-factor-recovery-codes": []string{payload},
+		"two-factor-settings":       user,
+		"two-factor-setup":          twoFactorSetup,
+		"user-info":                 user,
+		"verify-email-page":         handlers.VerifyEmailResponse{Error: payload},
+	}
+}
+
+func TestTemplatesEscapeUserInput(t *testing.T) {
+	loginProviders := []handlers.LoginProvider{{Name: xssText(), DisplayName: xssText()}}
+	parsed := parseTemplates(templatesPattern, loginProviders)
+	templates := newTemplates(parsed, 1)
+	data := xssTemplateData()
+
+	for _, tmpl := range parsed.Templates() {
+		name := tmpl.Name()
+		if name == "" || strings.HasSuffix(name, ".html") {
+			continue
+		}
+
+		if _, found := data[name]; !found {
+			t.Errorf("template %s has no test data", name)
+		}
+	}
+
+	for name, blockData := range data {
+		t.Run(name, func(t *testing.T) {
+			var page bytes.Buffer
+
+			err := templates.Render(&page, name, blockData, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, payload := range xssPayloads {
+				if strings.Contains(page.String(), payload) {
+					t.Errorf("%s is not escaped:\n%s", payload, page.String())
+				}
+			}
+		})
+	}
+}
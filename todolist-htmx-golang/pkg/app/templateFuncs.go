@@ -0,0 +1,65 @@
+package app
+
+import (
+	"bytes"
+	"html/template"
+	"strconv"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/handlers"
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+const dateLayout = "2006-01-02 15:04"
+
+func templateFuncs(loginProviders []handlers.LoginProvider) template.FuncMap {
+	markdownPolicy := bluemonday.UGCPolicy()
+
+	return template.FuncMap{
+		"csrfToken":       func() string { return "" },
+		"loginProviders":  func() []handlers.LoginProvider { return loginProviders },
+		"formatDate":      formatDate,
+		"pluralize":       pluralize,
+		"priorities":      func() []models.Priority { return models.Priorities },
+		"tagColors":       func() []string { return models.TagColors },
+		"tagForm":         models.NewTagForm,
+		"listForm":        models.NewListForm,
+		"listMembersForm": models.NewListMembersForm,
+		"subtasksForm":    models.NewSubtasksForm,
+		"markdown": func(source string) template.HTML {
+			return renderMarkdown(markdownPolicy, source)
+		},
+	}
+}
+
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+
+	return date.Format(dateLayout)
+}
+
+func pluralize(count int, singular, plural string) string {
+	if count == 1 {
+		return strconv.Itoa(count) + " " + singular
+	}
+
+	return strconv.Itoa(count) + " " + plural
+}
+
+// renderMarkdown converts user-provided Markdown into HTML and sanitizes the
+// result, so it is the only place allowed to produce template.HTML.
+func renderMarkdown(policy *bluemonday.Policy, source string) template.HTML {
+	var buf bytes.Buffer
+
+	err := goldmark.Convert([]byte(source), &buf)
+	if err != nil {
+		return template.HTML(template.HTMLEscapeString(source)) //nolint:gosec // escaped above
+	}
+
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())) //nolint:gosec // sanitized above
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+const templatesPattern = "../../templates/**/*.html"
+
+func TestTemplatesRenderTheTokenOfEachRequest(t *testing.T) {
+	templates := newTemplates(parseTemplates(templatesPattern, nil), 2)
+	server := echo.New()
+
+	var waitGroup sync.WaitGroup
+
+	for i := range 50 {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			token := fmt.Sprintf("token-%d", i)
+
+			ctx := server.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+			ctx.Set("csrf", token)
+
+			var page bytes.Buffer
+
+			err := templates.Render(&page, "csrf-field", nil, ctx)
+			if err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			if !strings.Contains(page.String(), `value="`+token+`"`) {
+				t.Errorf("page for %s has another token: %s", token, page.String())
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+}
+
+func TestTemplatesRenderReportsUnknownTemplates(t *testing.T) {
+	templates := newTemplates(parseTemplates(templatesPattern, nil), 1)
+
+	err := templates.Render(&bytes.Buffer{}, "no-such-template", nil, nil)
+	if err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+
+	// The clone must be handed back even when rendering fails.
+	err = templates.Render(&bytes.Buffer{}, "csrf-field", nil, nil)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -43,7 +43,152 @@ CREATE TABLE IF NOT EXISTS user_task (
     FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE,
 
     PRIMARY KEY (user_id, task_id)
-);`
+);
+
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_code (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+
+    FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE
+);
+
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS email TEXT;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_idx ON "user" (lower(email));
+
+CREATE TABLE IF NOT EXISTS email_verification_token (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL,
+    email TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+
+    FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_token (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+
+    FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_identity (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE,
+
+    UNIQUE (provider, subject)
+);
+
+CREATE TABLE IF NOT EXISTS api_token (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+
+    FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE
+);
+
+ALTER TABLE task ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE task ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT 'UTC';
+
+CREATE INDEX IF NOT EXISTS task_due_at_idx ON task (due_at);
+CREATE INDEX IF NOT EXISTS task_no_due_at_idx ON task (id) WHERE due_at IS NULL;
+
+ALTER TABLE task ADD COLUMN IF NOT EXISTS priority SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE task ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS task_priority_created_at_idx ON task (priority DESC, created_at, id);
+
+CREATE TABLE IF NOT EXISTS tag (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL,
+    name TEXT NOT NULL,
+    color TEXT NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE,
+
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS task_tag (
+    task_id INT NOT NULL,
+    tag_id INT NOT NULL,
+
+    FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tag(id) ON DELETE CASCADE,
+
+    PRIMARY KEY (task_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS task_tag_tag_id_idx ON task_tag (tag_id);
+
+CREATE TABLE IF NOT EXISTS task_list (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL,
+    name TEXT NOT NULL,
+    is_archived BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE,
+
+    UNIQUE (user_id, name)
+);
+
+ALTER TABLE task ADD COLUMN IF NOT EXISTS list_id INT REFERENCES task_list(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS task_list_id_idx ON task (list_id);
+
+CREATE TABLE IF NOT EXISTS task_list_member (
+    list_id INT NOT NULL,
+    user_id INT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('viewer', 'editor')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    FOREIGN KEY (list_id) REFERENCES task_list(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES "user"(id) ON DELETE CASCADE,
+
+    PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS task_list_member_user_id_idx ON task_list_member (user_id);
+
+CREATE TABLE IF NOT EXISTS subtask (
+    id SERIAL PRIMARY KEY NOT NULL,
+    task_id INT NOT NULL,
+    title TEXT NOT NULL,
+    is_done BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS subtask_task_id_idx ON subtask (task_id);
+
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS auto_complete_tasks BOOLEAN NOT NULL DEFAULT TRUE;`
 
 	_, err := postgresDB.Exec(initQuery)
 	if err != nil {
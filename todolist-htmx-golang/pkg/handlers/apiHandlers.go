@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+type APITaskListResponse struct {
+	Tasks models.Tasks `json:"tasks"`
+}
+
+// APITaskRequest is the body of task writes. Fields that are left out are not
+// changed by PATCH and are required by POST and PUT. PUT replaces the tags of
+// the task while PATCH adds them to the ones it has, and a task without a list
+// is in the Inbox.
+type APITaskRequest struct {
+	Title       *string          `json:"title"`
+	IsDone      *bool            `json:"isDone"`
+	Description *string          `json:"description"`
+	DueAt       *time.Time       `json:"dueAt"`
+	Priority    *models.Priority `json:"priority"`
+	Tags        []string         `json:"tags"`
+	ListID      *int             `json:"listId"`
+}
+
+func isAPIRequest(ctx echo.Context) bool {
+	return strings.HasPrefix(ctx.Request().URL.Path, "/api/")
+}
+
+func apiErrorResponse(ctx echo.Context, status int, detail string) error {
+	return problemResponse(ctx, ProblemDetails{Status: status, Detail: detail})
+}
+
+func apiTaskErrorResponse(ctx echo.Context, log *slog.Logger, err error) error {
+	switch {
+	case errors.Is(err, models.ErrTaskNotFound):
+		return apiErrorResponse(ctx, http.StatusNotFound, "Task is not found")
+	case errors.Is(err, models.ErrPermissionDenied):
+		return apiErrorResponse(ctx, http.StatusForbidden, "You can only view this task")
+	case isTaskValidationError(err):
+		return problemResponse(ctx, ProblemDetails{
+			Status: http.StatusUnprocessableEntity,
+			Title:  "Task is invalid",
+			Errors: map[string]string{taskValidationField(err): err.Error()},
+		})
+	default:
+		log.Error("failed to access a task", "err", err)
+
+		return apiErrorResponse(ctx, http.StatusInternalServerError, "Failed to access a task")
+	}
+}
+
+var errNotAuthenticated = errors.New("request is not authenticated")
+
+func apiUser(ctx echo.Context, userStorage UserStorage) (models.User, error) {
+	userID, isAuthenticated := authenticatedUserID(ctx)
+	if !isAuthenticated {
+		return models.User{}, errNotAuthenticated
+	}
+
+	return userStorage.GetUserWithID(userID)
+}
+
+func apiUserErrorResponse(ctx echo.Context, log *slog.Logger, err error) error {
+	if errors.Is(err, errNotAuthenticated) {
+		return apiErrorResponse(ctx, http.StatusUnauthorized, "Authentication is required")
+	}
+
+	log.Error("failed to get a user with id", "err", err)
+
+	return apiErrorResponse(ctx, http.StatusInternalServerError, "Failed to get a user")
+}
+
+func invalidTaskIDResponse(ctx echo.Context) error {
+	return apiErrorResponse(ctx, http.StatusBadRequest, "Task id must be a number")
+}
+
+func decodeAPITaskRequest(ctx echo.Context) (APITaskRequest, error) {
+	request := APITaskRequest{}
+
+	decoder := json.NewDecoder(ctx.Request().Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&request)
+
+	return request, err
+}
+
+func invalidBodyResponse(ctx echo.Context, err error) error {
+	return apiErrorResponse(ctx, http.StatusBadRequest, "Body must be a JSON task: "+err.Error())
+}
+
+func APICurrentUserHandler(userStorage UserStorage, log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		user, err := apiUser(ctx, userStorage)
+		if err != nil {
+			return apiUserErrorResponse(ctx, log, err)
+		}
+
+		return ctx.JSON(http.StatusOK, user)
+	}
+}
+
+func APIListTasksHandler(userStorage UserStorage, log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		user, err := apiUser(ctx, userStorage)
+		if err != nil {
+			return apiUserErrorResponse(ctx, log, err)
+		}
+
+		view, err := models.ParseTaskView(ctx.QueryParam("view"))
+		if err != nil {
+			return apiErrorResponse(ctx, http.StatusBadRequest, "View must be one of today, upcoming or nodate")
+		}
+
+		order, err := models.ParseTaskOrder(ctx.QueryParam("order"))
+		if err != nil {
+			return apiErrorResponse(ctx, http.StatusBadRequest, "Order must be one of created or due")
+		}
+
+		filter := models.TaskFilter{View: view, Order: order, Tag: ctx.QueryParam("tag")}
+
+		switch list := ctx.QueryParam("list"); list {
+		case "":
+		case "inbox":
+			filter.Inbox = true
+		default:
+			filter.ListID, err = strconv.Atoi(list)
+			if err != nil {
+				return apiErrorResponse(ctx, http.StatusBadRequest, "List must be inbox or a list id")
+			}
+		}
+
+		tasks, err := user.GetTasks(filter)
+		if err != nil {
+			return apiTaskErrorResponse(ctx, log, err)
+		}
+
+		return ctx.JSON(http.StatusOK, APITaskListResponse{tasks})
+	}
+}
+
+func APIGetTaskHandler(userStorage UserStorage, log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		user, err := apiUser(ctx, userStorage)
+		if err != nil {
+			return apiUserErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return invalidTaskIDResponse(ctx)
+		}
+
+		task, err := user.GetTaskByID(taskID)
+		if err != nil {
+			return apiTaskErrorResponse(ctx, log, err)
+		}
+
+		return ctx.JSON(http.StatusOK, task)
+	}
+}
+
+func APICreateTaskHandler(userStorage UserStorage, log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		user, err := apiUser(ctx, userStorage)
+		if err != nil {
+			return apiUserErrorResponse(ctx, log, err)
+		}
+
+		request, err := decodeAPITaskRequest(ctx)
+		if err != nil {
+			return invalidBodyResponse(ctx, err)
+		}
+
+		if request.Title == nil {
+			return apiTaskErrorResponse(ctx, log, models.ErrEmptyTaskTitle)
+		}
+
+		isDone := request.IsDone != nil && *request.IsDone
+
+		task, err := user.NewTask(models.TaskDraft{
+			Title:       *request.Title,
+			Description: stringValue(request.Description),
+			IsDone:      isDone,
+			DueAt:       request.DueAt,
+			Priority:    priorityValue(request.Priority),
+			Tags:        request.Tags,
+			ListID:      request.ListID,
+		})
+		if err != nil {
+			return apiTaskErrorResponse(ctx, log, err)
+		}
+
+		log.Info("POST /api/v1/tasks", "id", task.ID)
+
+		ctx.Response().Header().Set("Location", "/api/v1/tasks/"+strconv.Itoa(task.ID))
+
+		return ctx.JSON(http.StatusCreated, task)
+	}
+}
+
+// APIUpdateTaskHandler serves PUT, which needs every field, and PATCH, which
+// changes only the fields it is given.
+func APIUpdateTaskHandler(
+	userStorage UserStorage,
+	isPartial bool,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		user, err := apiUser(ctx, userStorage)
+		if err != nil {
+			return apiUserErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return invalidTaskIDResponse(ctx)
+		}
+
+		request, err := decodeAPITaskRequest(ctx)
+		if err != nil {
+			return invalidBodyResponse(ctx, err)
+		}
+
+		if !isPartial && (request.Title == nil || request.IsDone == nil) {
+			return problemResponse(ctx, ProblemDetails{
+				Status: http.StatusUnprocessableEntity,
+				Title:  "Task is incomplete",
+				Detail: "PUT needs every field of a task, use PATCH to change some of them",
+				Errors: missingTaskFields(request),
+			})
+		}
+
+		// A replaced task without a description, a due date, a priority or
+		// tags has none, and one without a list goes to the Inbox.
+		if !isPartial && request.Description == nil {
+			request.Description = new(string)
+		}
+
+		if !isPartial && request.Priority == nil {
+			request.Priority = new(models.Priority)
+		}
+
+		task, err := user.UpdateTask(taskID, models.TaskUpdate{
+			Title:       request.Title,
+			IsDone:      request.IsDone,
+			Description: request.Description,
+			DueAt:       request.DueAt,
+			RemoveDueAt: !isPartial && request.DueAt == nil,
+			Priority:    request.Priority,
+			AddTags:     request.Tags,
+			ReplaceTags: !isPartial,
+			ListID:      request.ListID,
+			MoveToInbox: !isPartial && request.ListID == nil,
+		})
+		if err != nil {
+			return apiTaskErrorResponse(ctx, log, err)
+		}
+
+		log.Info(ctx.Request().Method+" /api/v1/tasks/:id", "id", task.ID)
+
+		return ctx.JSON(http.StatusOK, task)
+	}
+}
+
+func missingTaskFields(request APITaskRequest) map[string]string {
+	fields := map[string]string{}
+
+	if request.Title == nil {
+		fields["title"] = "is required"
+	}
+
+	if request.IsDone == nil {
+		fields["isDone"] = "is required"
+	}
+
+	return fields
+}
+
+func APIDeleteTaskHandler(userStorage UserStorage, log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		user, err := apiUser(ctx, userStorage)
+		if err != nil {
+			return apiUserErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return invalidTaskIDResponse(ctx)
+		}
+
+		err = user.RemoveTask(taskID)
+		if err != nil {
+			return apiTaskErrorResponse(ctx, log, err)
+		}
+
+		log.Info("DELETE /api/v1/tasks/:id", "id", taskID)
+
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
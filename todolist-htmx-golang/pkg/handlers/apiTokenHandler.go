@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+type APITokenManager interface {
+	CreateAPIToken(userID int, name string, scopes []string, expiresAt *time.Time) (string, error)
+	GetAPITokens(userID int) ([]models.APIToken, error)
+	RevokeAPIToken(userID, tokenID int) error
+}
+
+func APITokensPageHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	tokenManager APITokenManager,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(session.UserID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		tokens, err := tokenManager.GetAPITokens(user.ID)
+		if err != nil {
+			log.Error("failed to get API tokens", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get API tokens")
+		}
+
+		return ctx.Render(http.StatusOK, "api-tokens-page", models.NewAPITokensPage(user, tokens))
+	}
+}
+
+// CreateAPITokenHandler shows the new token once; after that only its name
+// and scopes are known.
+func CreateAPITokenHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	tokenManager APITokenManager,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(session.UserID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		name := ctx.FormValue("name")
+
+		formData := models.NewFormData()
+		formData.Values["Name"] = name
+
+		expiresAt, err := apiTokenExpiry(ctx.FormValue("expires_in_days"))
+		if err != nil {
+			formData.Errors["ExpiresIn"] = "Choose a valid expiration"
+		}
+
+		scopes := []string{}
+
+		for _, scope := range []string{models.APITokenScopeRead, models.APITokenScopeWrite} {
+			if ctx.FormValue("scope_"+scope) != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		token := ""
+
+		if len(formData.Errors) == 0 {
+			token, err = tokenManager.CreateAPIToken(user.ID, name, scopes, expiresAt)
+
+			switch {
+			case errors.Is(err, models.ErrEmptyAPITokenName):
+				formData.Errors["Name"] = err.Error()
+			case errors.Is(err, models.ErrInvalidScopes):
+				formData.Errors["Scopes"] = err.Error()
+			case err != nil:
+				log.Error("failed to create an API token", "err", err)
+
+				return ctx.String(http.StatusInternalServerError, "Failed to create an API token")
+			}
+		}
+
+		log.Info("POST /settings/tokens", "userID", user.ID)
+
+		tokens, err := tokenManager.GetAPITokens(user.ID)
+		if err != nil {
+			log.Error("failed to get API tokens", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get API tokens")
+		}
+
+		page := models.NewAPITokensPage(user, tokens)
+		page.NewToken = token
+
+		if token == "" {
+			page.Form = formData
+		}
+
+		return ctx.Render(http.StatusOK, "api-tokens", page)
+	}
+}
+
+func RevokeAPITokenHandler(
+	sessionStore SessionStore,
+	tokenManager APITokenManager,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		tokenID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return ctx.String(http.StatusBadRequest, "Invalid id")
+		}
+
+		log.Info("DELETE /settings/tokens/:id", "userID", session.UserID, "tokenID", tokenID)
+
+		err = tokenManager.RevokeAPIToken(session.UserID, tokenID)
+		if errors.Is(err, models.ErrAPITokenNotFound) {
+			return ctx.String(http.StatusNotFound, "API token is not found")
+		}
+
+		if err != nil {
+			log.Error("failed to revoke an API token", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to revoke an API token")
+		}
+
+		return ctx.NoContent(http.StatusOK)
+	}
+}
+
+// apiTokenExpiry turns the number of days picked in the form into a date. An
+// empty value means the token doesn't expire.
+func apiTokenExpiry(days string) (*time.Time, error) {
+	if days == "" {
+		return nil, nil //nolint:nilnil // no expiry
+	}
+
+	count, err := strconv.Atoi(days)
+	if err != nil || count <= 0 {
+		return nil, errors.New("invalid number of days")
+	}
+
+	expiresAt := time.Now().AddDate(0, 0, count)
+
+	return &expiresAt, nil
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 
@@ -14,32 +15,95 @@ type PageCreator interface {
 }
 
 func BaseHandler(
-	sessionStore SessionStore,
 	userStorage UserStorage,
 	log *slog.Logger,
 ) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
-		login, err := sessionStore.GetSession(ctx.Request(), "session")
-		if err != nil {
-			log.Info("Not authorized! Redirecting...", "err", err)
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
 
 			return ctx.Redirect(http.StatusFound, "/login")
 		}
 
-		user, err := userStorage.GetUserWithLogin(login)
+		user, err := userStorage.GetUserWithID(userID)
 		if err != nil {
-			log.Error("failed to get user by login", "err", err)
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		return taskListPage(ctx, log, user, nil)
+	}
+}
+
+// taskListPage shows the tasks of a list, or of the Inbox when list is nil,
+// narrowed down by the query.
+func taskListPage(ctx echo.Context, log *slog.Logger, user models.User, list *models.List) error {
+	view, err := models.ParseTaskView(ctx.QueryParam("view"))
+	if err != nil {
+		return badTaskListQueryResponse(ctx, "View must be one of today, upcoming or nodate")
+	}
+
+	order, err := models.ParseTaskOrder(ctx.QueryParam("order"))
+	if err != nil {
+		return badTaskListQueryResponse(ctx, "Order must be one of created or due")
+	}
+
+	filter := models.TaskFilter{
+		View:  view,
+		Order: order,
+		Tag:   ctx.QueryParam("tag"),
+		Inbox: list == nil,
+	}
+
+	if list != nil {
+		filter.ListID = list.ID
+	}
+
+	tasklist, err := user.GetTasks(filter)
+	if err != nil {
+		log.Error("failed to get tasks:", "err", err)
+	}
 
-			return ctx.String(http.StatusInternalServerError, "failed to get user by login")
+	if wantsJSON(ctx) {
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
 		}
 
-		tasklist, err := user.GetTasks()
+		return ctx.JSON(http.StatusOK, APITaskListResponse{tasklist})
+	}
+
+	lists, err := user.GetLists()
+	if err != nil {
+		log.Error("failed to get lists:", "err", err)
+	}
+
+	page := models.NewPage(tasklist, user)
+	page.View = view
+	page.Order = order
+	page.Tag = filter.Tag
+	page.List = list
+	page.Lists = lists
+
+	if list != nil {
+		page.Form.Values["ListID"] = strconv.Itoa(list.ID)
+
+		page.Members, err = user.GetListMembers(list.ID)
 		if err != nil {
-			log.Error("failed to get tasks:", "err", err)
+			log.Error("failed to get list members:", "err", err)
 		}
+	}
 
-		page := models.NewPage(tasklist, user)
+	return ctx.Render(http.StatusOK, "tasklist-page", page)
+}
 
-		return ctx.Render(http.StatusOK, "tasklist-page", page)
+// badTaskListQueryResponse sends browsers that followed a stale link back to
+// the whole task list.
+func badTaskListQueryResponse(ctx echo.Context, detail string) error {
+	if wantsJSON(ctx) {
+		return problemResponse(ctx, ProblemDetails{Status: http.StatusBadRequest, Detail: detail})
 	}
+
+	return ctx.Redirect(http.StatusFound, "/")
 }
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+const (
+	csrfContextKey = "csrf"
+	csrfCookieName = "csrf"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFormField  = "csrf_token"
+)
+
+// CSRFMiddleware rejects state-changing requests that don't echo the CSRF token
+// back in the X-CSRF-Token header or the csrf_token form field. Logged in users
+// get the token of their session, anonymous visitors get one in a cookie.
+// Requests with an API token are skipped: browsers don't attach it on their
+// own, and AuthorizationCheckMiddleware ignores the cookie for them.
+func CSRFMiddleware(store SessionStore, log *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if _, isBearer := bearerToken(ctx.Request()); isBearer {
+				return next(ctx)
+			}
+
+			token, err := csrfTokenForRequest(ctx, store)
+			if err != nil {
+				log.Error("failed to get a csrf token", "err", err)
+
+				return ctx.String(http.StatusInternalServerError, "Failed to get a csrf token")
+			}
+
+			ctx.Set(csrfContextKey, token)
+
+			switch ctx.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(ctx)
+			}
+
+			providedToken := ctx.Request().Header.Get(csrfHeaderName)
+			if providedToken == "" {
+				providedToken = ctx.FormValue(csrfFormField)
+			}
+
+			if subtle.ConstantTimeCompare([]byte(providedToken), []byte(token)) != 1 {
+				log.Info("Invalid csrf token", "uri", ctx.Request().RequestURI)
+
+				if isAPIRequest(ctx) {
+					return apiErrorResponse(ctx, http.StatusForbidden, "Send the X-CSRF-Token header or use an API token")
+				}
+
+				if ctx.Request().Header.Get("HX-Request") == "true" {
+					ctx.Response().Header().Set("HX-Retarget", "body")
+					ctx.Response().Header().Set("HX-Reswap", "beforeend")
+				}
+
+				return ctx.Render(http.StatusForbidden, "csrf-error", nil)
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// CSRFToken returns the token that forms rendered for this request must send.
+func CSRFToken(ctx echo.Context) string {
+	token, _ := ctx.Get(csrfContextKey).(string)
+
+	return token
+}
+
+func csrfTokenForRequest(ctx echo.Context, store SessionStore) (string, error) {
+	session, err := store.GetSession(ctx.Request(), "session")
+	if err == nil && session.CSRFToken != "" {
+		return session.CSRFToken, nil
+	}
+
+	cookie, err := ctx.Cookie(csrfCookieName)
+	if err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+
+	token, err := models.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	ctx.SetCookie(&http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+	})
+
+	return token, nil
+}
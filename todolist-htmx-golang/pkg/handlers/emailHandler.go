@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/mailer"
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+type EmailVerifier interface {
+	ChangeEmail(userID int, email string) (string, error)
+	CreateEmailVerificationToken(userID int, email string) (string, error)
+	VerifyEmail(token string) error
+}
+
+type VerifyEmailResponse struct {
+	Error string
+}
+
+// RequireVerifiedEmail guards features that send mail to the user, like
+// reminders and sharing, until the user has verified an address. It runs after
+// AuthorizationCheckMiddleware, so it covers API tokens as well as sessions.
+func RequireVerifiedEmail(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			userID, isAuthenticated := authenticatedUserID(ctx)
+			if !isAuthenticated {
+				log.Info("Not authorized! Redirecting...")
+
+				return ctx.Redirect(http.StatusFound, "/login")
+			}
+
+			user, err := userStorage.GetUserWithID(userID)
+			if err != nil {
+				log.Error("failed to get user by id", "err", err)
+
+				return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+			}
+
+			if !user.EmailVerified {
+				log.Info("email is not verified", "userID", user.ID, "path", ctx.Path())
+
+				return detailErrorResponse(ctx, http.StatusForbidden, "Verify your email address in the settings first")
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+func VerifyEmailHandler(verifier EmailVerifier, log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		log.Info("GET /verify-email")
+
+		response := VerifyEmailResponse{}
+
+		err := verifier.VerifyEmail(ctx.QueryParam("token"))
+		if errors.Is(err, models.ErrInvalidVerificationToken) {
+			response.Error = err.Error()
+		} else if err != nil {
+			log.Error("failed to verify an email", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to verify an email")
+		}
+
+		return ctx.Render(http.StatusOK, "verify-email-page", response)
+	}
+}
+
+func ChangeEmailHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	verifier EmailVerifier,
+	mail mailer.Mailer,
+	baseURL string,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(session.UserID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		page := models.NewSettingsPage(user)
+		email := ctx.FormValue("email")
+
+		if email == user.Email {
+			return ctx.Render(http.StatusOK, "email-settings", page)
+		}
+
+		email, err = verifier.ChangeEmail(user.ID, email)
+		if errors.Is(err, models.ErrInvalidEmail) || errors.Is(err, models.ErrEmailAlreadyUsed) {
+			page.EmailForm.Values["Email"] = ctx.FormValue("email")
+			page.EmailForm.Errors["Email"] = err.Error()
+
+			return ctx.Render(http.StatusOK, "email-settings", page)
+		}
+
+		if err != nil {
+			log.Error("failed to change an email", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to change an email")
+		}
+
+		log.Info("POST /settings/email", "userID", user.ID)
+
+		page.User.Email = email
+		page.User.EmailVerified = false
+
+		err = sendVerificationMail(verifier, mail, baseURL, page.User)
+		if err != nil {
+			log.Error("failed to send a verification mail", "err", err)
+
+			page.EmailForm.Errors["Email"] = "Failed to send a verification link, try again later"
+
+			return ctx.Render(http.StatusOK, "email-settings", page)
+		}
+
+		page.EmailForm.Values["Message"] = "We've sent a verification link to " + email
+
+		return ctx.Render(http.StatusOK, "email-settings", page)
+	}
+}
+
+func ResendVerificationHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	verifier EmailVerifier,
+	mail mailer.Mailer,
+	baseURL string,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(session.UserID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		page := models.NewSettingsPage(user)
+
+		if user.Email == "" || user.EmailVerified {
+			return ctx.Render(http.StatusOK, "email-settings", page)
+		}
+
+		log.Info("POST /settings/email/verify", "userID", user.ID)
+
+		err = sendVerificationMail(verifier, mail, baseURL, user)
+		if err != nil {
+			log.Error("failed to send a verification mail", "err", err)
+
+			page.EmailForm.Errors["Email"] = "Failed to send a verification link, try again later"
+
+			return ctx.Render(http.StatusOK, "email-settings", page)
+		}
+
+		page.EmailForm.Values["Message"] = "We've sent a verification link to " + user.Email
+
+		return ctx.Render(http.StatusOK, "email-settings", page)
+	}
+}
+
+func sendVerificationMail(
+	verifier EmailVerifier,
+	mail mailer.Mailer,
+	baseURL string,
+	user models.User,
+) error {
+	token, err := verifier.CreateEmailVerificationToken(user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+
+	link := baseURL + "/verify-email?token=" + url.QueryEscape(token)
+
+	return mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Hi " + user.Login + ",\n\n" +
+			"Open this link within a day to verify your email address:\n" + link + "\n\n" +
+			"If you didn't use this address for a todolist account, ignore this mail.\n",
+	})
+}
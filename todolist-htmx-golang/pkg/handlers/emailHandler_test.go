@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/mailer"
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+// smtpStandIn is a minimal SMTP server that accepts every message and hands
+// its raw data to the test.
+type smtpStandIn struct {
+	listener net.Listener
+	messages chan string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &smtpStandIn{listener: listener, messages: make(chan string, 10)}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go server.serve()
+
+	return server
+}
+
+func (server *smtpStandIn) hostPort() (string, string) {
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+
+	return host, port
+}
+
+func (server *smtpStandIn) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go server.handle(conn)
+	}
+}
+
+func (server *smtpStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost SMTP stand-in")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 end data with <CR><LF>.<CR><LF>")
+
+			var data strings.Builder
+
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				if dataLine == ".\r\n" {
+					break
+				}
+
+				data.WriteString(dataLine)
+			}
+
+			server.messages <- data.String()
+
+			reply("250 OK")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 bye")
+
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (server *smtpStandIn) nextMessage(t *testing.T) string {
+	t.Helper()
+
+	select {
+	case message := <-server.messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail was sent")
+
+		return ""
+	}
+}
+
+// emailUsers keeps accounts and verification tokens in memory.
+type emailUsers struct {
+	mutex  sync.Mutex
+	users  map[int]models.User
+	tokens map[string]int
+}
+
+func newEmailUsers() *emailUsers {
+	return &emailUsers{users: map[int]models.User{}, tokens: map[string]int{}}
+}
+
+func (storage *emailUsers) GetUserWithID(userID int) (models.User, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	user, found := storage.users[userID]
+	if !found {
+		return models.User{}, models.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (storage *emailUsers) Register(login, _, email string) (models.User, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	user := models.User{ID: len(storage.users) + 1, Login: login, Email: email}
+	storage.users[user.ID] = user
+
+	return user, nil
+}
+
+func (storage *emailUsers) Login(string, string) (models.User, error) {
+	return models.User{}, models.ErrUserNotFound
+}
+
+func (storage *emailUsers) ChangeEmail(int, string) (string, error) {
+	return "", errors.ErrUnsupported
+}
+
+func (storage *emailUsers) CreateEmailVerificationToken(userID int, _ string) (string, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	token, err := models.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	storage.tokens[token] = userID
+
+	return token, nil
+}
+
+func (storage *emailUsers) VerifyEmail(token string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	userID, found := storage.tokens[token]
+	if !found {
+		return models.ErrInvalidVerificationToken
+	}
+
+	delete(storage.tokens, token)
+
+	user := storage.users[userID]
+	user.EmailVerified = true
+	storage.users[userID] = user
+
+	return nil
+}
+
+var verificationLinkPattern = regexp.MustCompile(`http://\S+/verify-email\?token=\S+`)
+
+func TestSharingNeedsAnAddressVerifiedThroughSMTP(t *testing.T) {
+	const baseURL = "http://todolist.test"
+
+	smtpServer := newSMTPStandIn(t)
+	host, port := smtpServer.hostPort()
+	log := discardLogger()
+	users := newEmailUsers()
+
+	server := echo.New()
+	server.Renderer = &testRenderer{}
+
+	smtpMailer := mailer.NewSMTPMailer(host, port, "", "", "todolist@test")
+
+	server.POST("/register", RegisterUserHandler(users, users, smtpMailer, baseURL, log))
+	server.GET("/verify-email", VerifyEmailHandler(users, log))
+
+	// Stands in for AuthorizationCheckMiddleware with the registered user.
+	authenticated := server.Group("", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(userIDContextKey, 1)
+
+			return next(ctx)
+		}
+	})
+	authenticated.DELETE("/lists/:id/members/:user_id", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "removed")
+	})
+
+	verified := authenticated.Group("", RequireVerifiedEmail(users, log))
+	verified.POST("/lists/:id/members", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "shared")
+	})
+
+	serve := func(method, target string, form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	share := url.Values{"login": {"bob"}, "role": {"viewer"}}
+
+	response := serve(http.MethodPost, "/register",
+		url.Values{"login": {"alice"}, "password": {"password"}, "email": {"alice@example.com"}})
+	if response.Code != http.StatusFound {
+		t.Fatalf("register: status = %d, want %d", response.Code, http.StatusFound)
+	}
+
+	response = serve(http.MethodPost, "/lists/1/members", share)
+	if response.Code != http.StatusForbidden {
+		t.Fatalf("share before verifying: status = %d, want %d", response.Code, http.StatusForbidden)
+	}
+
+	// Owners can still revoke access and members can still leave.
+	response = serve(http.MethodDelete, "/lists/1/members/2", nil)
+	if response.Code != http.StatusOK {
+		t.Fatalf("remove member before verifying: status = %d, want %d", response.Code, http.StatusOK)
+	}
+
+	message := smtpServer.nextMessage(t)
+
+	if !strings.Contains(message, "To: alice@example.com") {
+		t.Errorf("mail is not sent to the registered address:\n%s", message)
+	}
+
+	link := verificationLinkPattern.FindString(message)
+	if link == "" {
+		t.Fatalf("mail has no verification link:\n%s", message)
+	}
+
+	response = serve(http.MethodGet, strings.TrimPrefix(link, baseURL), nil)
+	if response.Code != http.StatusOK {
+		t.Fatalf("verify: status = %d, want %d", response.Code, http.StatusOK)
+	}
+
+	response = serve(http.MethodPost, "/lists/1/members", share)
+	if response.Code != http.StatusOK {
+		t.Errorf("share after verifying: status = %d, want %d", response.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/labstack/echo/v4"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// testRenderer writes the name of the template instead of rendering it, and
+// remembers the data it was given.
+type testRenderer struct {
+	name string
+	data any
+}
+
+func (renderer *testRenderer) Render(w io.Writer, name string, data interface{}, _ echo.Context) error {
+	renderer.name = name
+	renderer.data = data
+
+	_, err := fmt.Fprint(w, name)
+
+	return err
+}
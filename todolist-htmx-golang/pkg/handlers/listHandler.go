@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+// ListHandler shows the tasks of a list the way BaseHandler shows the Inbox.
+func ListHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		listID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return listErrorResponse(ctx, log, errInvalidListID)
+		}
+
+		list, err := user.GetList(listID)
+		if err != nil {
+			return listErrorResponse(ctx, log, err)
+		}
+
+		return taskListPage(ctx, log, user, &list)
+	}
+}
+
+// CreateListHandler sends the browser to the new list, or shows the form again
+// when the name doesn't fit.
+func CreateListHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		name := ctx.FormValue("name")
+
+		list, err := user.CreateList(name)
+		if isListValidationError(err) {
+			formData := models.NewFormData()
+			formData.Values["Name"] = name
+			formData.Errors["Name"] = err.Error()
+
+			return ctx.Render(http.StatusOK, "list-create-form", formData)
+		}
+
+		if err != nil {
+			return listErrorResponse(ctx, log, err)
+		}
+
+		log.Info("POST /lists", "userID", user.ID, "listID", list.ID)
+
+		ctx.Response().Header().Set("HX-Redirect", "/lists/"+strconv.Itoa(list.ID))
+
+		return ctx.NoContent(http.StatusOK)
+	}
+}
+
+// UpdateListHandler renames a list with the name field and archives or
+// restores it with the archived field.
+func UpdateListHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		listID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return listErrorResponse(ctx, log, errInvalidListID)
+		}
+
+		form, err := ctx.FormParams()
+		if err != nil {
+			return detailErrorResponse(ctx, http.StatusBadRequest, "Invalid form")
+		}
+
+		update := models.ListUpdate{}
+
+		if form.Has("name") {
+			name := form.Get("name")
+			update.Name = &name
+		}
+
+		if form.Has("archived") {
+			isArchived, err := strconv.ParseBool(form.Get("archived"))
+			if err != nil {
+				return detailErrorResponse(ctx, http.StatusBadRequest, "Archived must be true or false")
+			}
+
+			update.IsArchived = &isArchived
+		}
+
+		log.Info("PATCH /lists/:id", "userID", user.ID, "listID", listID)
+
+		_, err = user.UpdateList(listID, update)
+		if isListValidationError(err) {
+			list, getErr := user.GetList(listID)
+			if getErr != nil {
+				return listErrorResponse(ctx, log, getErr)
+			}
+
+			listForm := models.NewListForm(list)
+			listForm.Form.Values["Name"] = form.Get("name")
+			listForm.Form.Errors["Name"] = err.Error()
+
+			return ctx.Render(http.StatusOK, "list-header", listForm)
+		}
+
+		if err != nil {
+			return listErrorResponse(ctx, log, err)
+		}
+
+		ctx.Response().Header().Set("HX-Redirect", "/lists/"+strconv.Itoa(listID))
+
+		return ctx.NoContent(http.StatusOK)
+	}
+}
+
+// DeleteListHandler deletes a list with its tasks and sends the browser back
+// to the Inbox.
+func DeleteListHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		listID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return listErrorResponse(ctx, log, errInvalidListID)
+		}
+
+		log.Info("DELETE /lists/:id", "userID", user.ID, "listID", listID)
+
+		err = user.DeleteList(listID)
+		if err != nil {
+			return listErrorResponse(ctx, log, err)
+		}
+
+		ctx.Response().Header().Set("HX-Redirect", "/")
+
+		return ctx.NoContent(http.StatusOK)
+	}
+}
+
+var errInvalidListID = errors.New("list id must be a number")
+
+func isListValidationError(err error) bool {
+	return errors.Is(err, models.ErrEmptyListName) ||
+		errors.Is(err, models.ErrListNameTooLong) ||
+		errors.Is(err, models.ErrListAlreadyExist)
+}
+
+func listErrorResponse(ctx echo.Context, log *slog.Logger, err error) error {
+	status := http.StatusInternalServerError
+	message := "Failed to access a list"
+
+	switch {
+	case errors.Is(err, errInvalidListID):
+		status = http.StatusBadRequest
+		message = "List id must be a number"
+	case errors.Is(err, models.ErrListNotFound):
+		log.Info("List not found", "err", err)
+
+		status = http.StatusNotFound
+		message = "List is not found"
+	case errors.Is(err, models.ErrPermissionDenied):
+		log.Info("List change is not allowed", "err", err)
+
+		status = http.StatusForbidden
+		message = "Only the owner of the list can do that"
+	default:
+		log.Error("failed to access a list", "err", err)
+	}
+
+	return detailErrorResponse(ctx, status, message)
+}
@@ -8,17 +8,20 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// NewLoggerMiddleware logs every request by its path only, since query strings
+// carry secrets such as the tokens of password reset and email verification
+// links.
 func NewLoggerMiddleware(log *slog.Logger) echo.MiddlewareFunc {
 	logValesFunc := func(_ echo.Context, loggerValues middleware.RequestLoggerValues) error {
 		if loggerValues.Error == nil {
 			log.LogAttrs(context.Background(), slog.LevelInfo, "REQUEST",
-				slog.String("uri", loggerValues.URI),
+				slog.String("path", loggerValues.URIPath),
 				slog.String("method", loggerValues.Method),
 				slog.Int("status", loggerValues.Status),
 			)
 		} else {
 			log.LogAttrs(context.Background(), slog.LevelError, "REQUEST_ERROR",
-				slog.String("uri", loggerValues.URI),
+				slog.String("path", loggerValues.URIPath),
 				slog.String("method", loggerValues.Method),
 				slog.Int("status", loggerValues.Status),
 				slog.String("err", loggerValues.Error.Error()),
@@ -31,7 +34,7 @@ func NewLoggerMiddleware(log *slog.Logger) echo.MiddlewareFunc {
 	loggerConfig := middleware.RequestLoggerConfig{
 		LogStatus:     true,
 		LogMethod:     true,
-		LogURI:        true,
+		LogURIPath:    true,
 		LogError:      true,
 		HandleError:   true,
 		LogValuesFunc: logValesFunc,
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestLoggerMiddlewareLeavesOutQueryStrings(t *testing.T) {
+	const token = "s3cr3t-link-token"
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		path   string
+	}{
+		{"reset password link", "/reset-password?token=" + token, http.StatusOK, "/reset-password"},
+		{"email verification link", "/verify-email?token=" + token, http.StatusOK, "/verify-email"},
+		{"failing request", "/verify-email?token=" + token, http.StatusBadRequest, "/verify-email"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+
+			server := echo.New()
+			server.Use(NewLoggerMiddleware(slog.New(slog.NewTextHandler(&buffer, nil))))
+
+			handler := func(ctx echo.Context) error {
+				if test.status != http.StatusOK {
+					return echo.NewHTTPError(test.status, "invalid link")
+				}
+
+				return ctx.NoContent(http.StatusOK)
+			}
+			server.GET(test.path, handler)
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.target, nil))
+
+			output := buffer.String()
+
+			if strings.Contains(output, token) {
+				t.Errorf("link token reached the log: %s", output)
+			}
+
+			if !strings.Contains(output, "path="+test.path) {
+				t.Errorf("log is missing the path %s: %s", test.path, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIMEApplicationProblemJSON is the media type of a ProblemDetails document.
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// ProblemDetails is an RFC 9457 problem document, the body of every JSON
+// error: of /api/v1, of failed authentication and of the task routes when a
+// client asks for JSON.
+type ProblemDetails struct {
+	Type   string            `json:"type"`
+	Title  string            `json:"title"`
+	Status int               `json:"status"`
+	Detail string            `json:"detail,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// wantsJSON reports whether the client prefers JSON over HTML. htmx requests
+// always get HTML, and so does a client that accepts both equally.
+func wantsJSON(ctx echo.Context) bool {
+	if ctx.Request().Header.Get("HX-Request") == "true" {
+		return false
+	}
+
+	accept := ctx.Request().Header.Get(echo.HeaderAccept)
+	if accept == "" {
+		return false
+	}
+
+	return acceptQuality(accept, echo.MIMEApplicationJSON) > acceptQuality(accept, echo.MIMETextHTML)
+}
+
+// acceptQuality returns the q-value the Accept header gives to the media type,
+// taken from the most specific range that matches it.
+func acceptQuality(accept, mediaType string) float64 {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	quality := 0.0
+	specificity := -1
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		rangeType := strings.ToLower(strings.TrimSpace(params[0]))
+
+		rangeSpecificity := -1
+
+		switch rangeType {
+		case mediaType:
+			rangeSpecificity = 2
+		case mainType + "/*":
+			rangeSpecificity = 1
+		case "*/*":
+			rangeSpecificity = 0
+		}
+
+		if rangeSpecificity <= specificity {
+			continue
+		}
+
+		rangeQuality := 1.0
+
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err == nil {
+					rangeQuality = parsed
+				}
+			}
+		}
+
+		quality = rangeQuality
+		specificity = rangeSpecificity
+	}
+
+	return quality
+}
+
+func problemResponse(ctx echo.Context, problem ProblemDetails) error {
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+
+	return ctx.JSON(problem.Status, problem)
+}
+
+// detailErrorResponse answers with a problem document when the client asks for
+// JSON, and with the detail as plain text otherwise.
+func detailErrorResponse(ctx echo.Context, status int, detail string) error {
+	if wantsJSON(ctx) {
+		return problemResponse(ctx, ProblemDetails{Status: status, Detail: detail})
+	}
+
+	return ctx.String(status, detail)
+}
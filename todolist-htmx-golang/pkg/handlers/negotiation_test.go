@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+func TestNegotiatedErrorsUseTheAPIEnvelope(t *testing.T) {
+	log := discardLogger()
+
+	routes := map[string]echo.HandlerFunc{
+		"/api/v1/tasks/:id": func(ctx echo.Context) error {
+			return apiTaskErrorResponse(ctx, log, models.ErrTaskNotFound)
+		},
+		"/task/:id": func(ctx echo.Context) error {
+			return taskErrorResponse(ctx, log, models.ErrTaskNotFound)
+		},
+		"/lists/:id": func(ctx echo.Context) error {
+			return listErrorResponse(ctx, log, models.ErrListNotFound)
+		},
+	}
+
+	server := echo.New()
+	for path, handler := range routes {
+		server.GET(path, handler)
+	}
+
+	acceptJSON := map[string]string{echo.HeaderAccept: echo.MIMEApplicationJSON}
+
+	tests := []struct {
+		name     string
+		target   string
+		headers  map[string]string
+		wantJSON bool
+	}{
+		{"API", "/api/v1/tasks/1", nil, true},
+		{"task asking for JSON", "/task/1", acceptJSON, true},
+		{"list preferring JSON", "/lists/1", map[string]string{echo.HeaderAccept: "application/json, text/html;q=0.5"}, true},
+		{"task asking for HTML", "/task/1", map[string]string{echo.HeaderAccept: echo.MIMETextHTML}, false},
+		{"htmx", "/task/1", map[string]string{echo.HeaderAccept: echo.MIMEApplicationJSON, "HX-Request": "true"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, test.target, nil)
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusNotFound)
+			}
+
+			contentType := recorder.Header().Get(echo.HeaderContentType)
+			if (contentType == MIMEApplicationProblemJSON) != test.wantJSON {
+				t.Fatalf("Content-Type = %q", contentType)
+			}
+
+			if !test.wantJSON {
+				return
+			}
+
+			problem := ProblemDetails{}
+
+			err := json.Unmarshal(recorder.Body.Bytes(), &problem)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if problem.Type != "about:blank" || problem.Title != http.StatusText(http.StatusNotFound) ||
+				problem.Status != http.StatusNotFound || problem.Detail == "" {
+				t.Errorf("problem = %+v", problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+type OIDCProvider interface {
+	AuthCodeURL(state, nonce, codeVerifier string) string
+	Exchange(
+		ctx context.Context,
+		code string,
+		codeVerifier string,
+		nonce string,
+	) (models.ExternalIdentity, error)
+}
+
+type OIDCStateStore interface {
+	SetOIDCState(response *http.ResponseWriter, key string, state models.OIDCState) (string, error)
+	TakeOIDCState(
+		response *http.ResponseWriter,
+		request *http.Request,
+		key string,
+		stateToken string,
+	) (models.OIDCState, error)
+}
+
+type IdentityAuth interface {
+	LoginWithIdentity(identity models.ExternalIdentity) (models.User, error)
+	LinkIdentity(userID int, identity models.ExternalIdentity) error
+	GetUserIdentities(userID int) ([]models.LinkedIdentity, error)
+}
+
+// LoginProvider is an identity provider as it is shown on the login and
+// settings pages.
+type LoginProvider struct {
+	Name        string
+	DisplayName string
+}
+
+type OIDCErrorResponse struct {
+	Error   string
+	BackURL string
+}
+
+type IdentitiesResponse struct {
+	Identities []models.LinkedIdentity
+}
+
+func OIDCLoginHandler(
+	stateStore OIDCStateStore,
+	providers map[string]OIDCProvider,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		log.Info("GET /login/oidc/:provider", "provider", ctx.Param("provider"))
+
+		return startOIDCLogin(ctx, stateStore, providers, 0, log)
+	}
+}
+
+func LinkIdentityHandler(
+	sessionStore SessionStore,
+	stateStore OIDCStateStore,
+	providers map[string]OIDCProvider,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		log.Info("POST /settings/identities/:provider", "provider", ctx.Param("provider"))
+
+		return startOIDCLogin(ctx, stateStore, providers, session.UserID, log)
+	}
+}
+
+func startOIDCLogin(
+	ctx echo.Context,
+	stateStore OIDCStateStore,
+	providers map[string]OIDCProvider,
+	linkUserID int,
+	log *slog.Logger,
+) error {
+	providerName := ctx.Param("provider")
+
+	provider, isFound := providers[providerName]
+	if !isFound {
+		return ctx.String(http.StatusNotFound, "Unknown identity provider")
+	}
+
+	nonce, err := models.NewToken()
+	if err != nil {
+		log.Error("failed to create a nonce", "err", err)
+
+		return ctx.String(http.StatusInternalServerError, "Failed to login")
+	}
+
+	state := models.OIDCState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		LinkUserID:   linkUserID,
+	}
+
+	stateToken, err := stateStore.SetOIDCState(&ctx.Response().Writer, "oidc_state", state)
+	if err != nil {
+		log.Error("failed to set an oidc state", "err", err)
+
+		return ctx.String(http.StatusInternalServerError, "Failed to login")
+	}
+
+	return ctx.Redirect(
+		http.StatusFound,
+		provider.AuthCodeURL(stateToken, state.Nonce, state.CodeVerifier),
+	)
+}
+
+func OIDCCallbackHandler(
+	sessionStore SessionStore,
+	stateStore OIDCStateStore,
+	identityAuth IdentityAuth,
+	providers map[string]OIDCProvider,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		providerName := ctx.Param("provider")
+
+		log.Info("GET /login/oidc/:provider/callback", "provider", providerName)
+
+		state, err := stateStore.TakeOIDCState(
+			&ctx.Response().Writer,
+			ctx.Request(),
+			"oidc_state",
+			ctx.QueryParam("state"),
+		)
+		if errors.Is(err, models.ErrInvalidOIDCState) {
+			return oidcErrorResponse(ctx, err.Error(), "/login")
+		}
+
+		if err != nil {
+			log.Error("failed to get an oidc state", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to login")
+		}
+
+		backURL := "/login"
+		if state.LinkUserID != 0 {
+			backURL = "/settings"
+		}
+
+		provider, isFound := providers[providerName]
+		if !isFound || state.Provider != providerName {
+			return oidcErrorResponse(ctx, models.ErrInvalidOIDCState.Error(), backURL)
+		}
+
+		if providerError := ctx.QueryParam("error"); providerError != "" {
+			log.Info("identity provider returned an error",
+				"provider", providerName,
+				"error", providerError,
+				"description", ctx.QueryParam("error_description"),
+			)
+
+			return oidcErrorResponse(ctx, "The identity provider refused the login", backURL)
+		}
+
+		identity, err := provider.Exchange(
+			ctx.Request().Context(),
+			ctx.QueryParam("code"),
+			state.CodeVerifier,
+			state.Nonce,
+		)
+		if err != nil {
+			log.Error("failed to exchange an authorization code", "provider", providerName, "err", err)
+
+			return oidcErrorResponse(ctx, "Failed to login with the identity provider", backURL)
+		}
+
+		if state.LinkUserID != 0 {
+			return linkIdentity(ctx, sessionStore, identityAuth, state.LinkUserID, identity, log)
+		}
+
+		user, err := identityAuth.LoginWithIdentity(identity)
+		if err != nil {
+			log.Error("failed to login with an identity", "provider", providerName, "err", err)
+
+			return oidcErrorResponse(ctx, "Failed to login with the identity provider", backURL)
+		}
+
+		if user.TOTPEnabled {
+			err = sessionStore.SetPendingSession(&ctx.Response().Writer, "pending_2fa", user.ID)
+			if err != nil {
+				log.Error("failed to set a pending session", "err", err)
+
+				return ctx.String(http.StatusInternalServerError, "Failed to login")
+			}
+
+			log.Debug("identity provider login waiting for a second factor", "provider", providerName, "login", user.Login)
+
+			return ctx.Render(http.StatusOK, "login-2fa-page", TwoFactorFormResponse{})
+		}
+
+		session := models.Session{
+			UserID:    user.ID,
+			IP:        ctx.RealIP(),
+			UserAgent: ctx.Request().UserAgent(),
+		}
+
+		err = sessionStore.SetSession(&ctx.Response().Writer, "session", session)
+		if err != nil {
+			log.Error("failed to set a session", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to login")
+		}
+
+		log.Debug("logged in with an identity provider", "provider", providerName, "login", user.Login)
+
+		return ctx.Redirect(http.StatusFound, "/")
+	}
+}
+
+// linkIdentity finishes linking only in the session that started it, so a
+// callback URL sent to someone else can't link an identity to their account.
+func linkIdentity(
+	ctx echo.Context,
+	sessionStore SessionStore,
+	identityAuth IdentityAuth,
+	userID int,
+	identity models.ExternalIdentity,
+	log *slog.Logger,
+) error {
+	session, err := sessionStore.GetSession(ctx.Request(), "session")
+	if err != nil || session.UserID != userID {
+		log.Info("identity link finished outside of its session", "err", err)
+
+		return oidcErrorResponse(ctx, models.ErrInvalidOIDCState.Error(), "/settings")
+	}
+
+	err = identityAuth.LinkIdentity(userID, identity)
+	if errors.Is(err, models.ErrIdentityAlreadyLinked) {
+		return oidcErrorResponse(ctx, err.Error(), "/settings")
+	}
+
+	if err != nil {
+		log.Error("failed to link an identity", "err", err)
+
+		return ctx.String(http.StatusInternalServerError, "Failed to link an identity")
+	}
+
+	return ctx.Redirect(http.StatusFound, "/settings")
+}
+
+func oidcErrorResponse(ctx echo.Context, message string, backURL string) error {
+	response := OIDCErrorResponse{
+		Error:   message,
+		BackURL: backURL,
+	}
+
+	return ctx.Render(http.StatusBadRequest, "oidc-error-page", response)
+}
+
+func IdentitiesHandler(
+	sessionStore SessionStore,
+	identityAuth IdentityAuth,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		identities, err := identityAuth.GetUserIdentities(session.UserID)
+		if err != nil {
+			log.Error("failed to get user identities", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to get linked accounts")
+		}
+
+		return ctx.Render(http.StatusOK, "linked-identities", IdentitiesResponse{identities})
+	}
+}
@@ -0,0 +1,549 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+	"github.com/deeprecession/golang-htmx-crud/pkg/oidc"
+)
+
+const (
+	fakeIdPClientID = "todolist"
+	fakeIdPKeyID    = "test-key"
+)
+
+// fakeIdP is an in-process OpenID Connect provider. It logs in Subject on
+// every authorization request and checks the PKCE verifier of the exchange.
+type fakeIdP struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	subject string
+	nonce   string
+
+	mutex      sync.Mutex
+	challenges map[string]string
+	nonces     map[string]string
+}
+
+func newFakeIdP(t *testing.T, subject string) *fakeIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &fakeIdP{
+		key:        key,
+		subject:    subject,
+		challenges: map[string]string{},
+		nonces:     map[string]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("GET /jwks", idp.jwks)
+	mux.HandleFunc("GET /authorize", idp.authorize)
+	mux.HandleFunc("POST /token", idp.token)
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *fakeIdP) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{
+		"issuer":                                idp.server.URL,
+		"authorization_endpoint":                idp.server.URL + "/authorize",
+		"token_endpoint":                        idp.server.URL + "/token",
+		"jwks_uri":                              idp.server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (idp *fakeIdP) jwks(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &idp.key.PublicKey,
+		KeyID:     fakeIdPKeyID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+func (idp *fakeIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	code, err := models.NewToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	idp.mutex.Lock()
+	idp.challenges[code] = query.Get("code_challenge")
+	idp.nonces[code] = query.Get("nonce")
+	idp.mutex.Unlock()
+
+	redirect := query.Get("redirect_uri") + "?" + url.Values{
+		"code":  {code},
+		"state": {query.Get("state")},
+	}.Encode()
+
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	code := r.FormValue("code")
+
+	idp.mutex.Lock()
+	challenge, found := idp.challenges[code]
+	nonce := idp.nonces[code]
+	delete(idp.challenges, code)
+	idp.mutex.Unlock()
+
+	verifierHash := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !found || base64.RawURLEncoding.EncodeToString(verifierHash[:]) != challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+
+		return
+	}
+
+	if idp.nonce != "" {
+		nonce = idp.nonce
+	}
+
+	idToken, err := idp.sign(map[string]any{
+		"iss":                idp.server.URL,
+		"sub":                idp.subject,
+		"aud":                fakeIdPClientID,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              nonce,
+		"email":              idp.subject + "@example.com",
+		"email_verified":     true,
+		"preferred_username": idp.subject,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (idp *fakeIdP) sign(claims map[string]any) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: idp.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", fakeIdPKeyID),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return signature.CompactSerialize()
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// memorySessions records the sessions and OIDC states the handlers set. Every
+// request is signed in as signedInUserID unless it is zero.
+type memorySessions struct {
+	signedInUserID  int
+	sessions        []models.Session
+	pendingSessions []int
+	states          map[string]models.OIDCState
+}
+
+func newMemorySessions() *memorySessions {
+	return &memorySessions{states: map[string]models.OIDCState{}}
+}
+
+func (store *memorySessions) GetSession(*http.Request, string) (models.Session, error) {
+	if store.signedInUserID == 0 {
+		return models.Session{}, models.ErrSessionNotFound
+	}
+
+	return models.Session{ID: "session", UserID: store.signedInUserID}, nil
+}
+
+func (store *memorySessions) SetSession(_ *http.ResponseWriter, _ string, session models.Session) error {
+	store.sessions = append(store.sessions, session)
+
+	return nil
+}
+
+func (store *memorySessions) DeleteSession(*http.ResponseWriter, *http.Request, string) error {
+	return nil
+}
+
+func (store *memorySessions) RevokeSession(int, string) error {
+	return nil
+}
+
+func (store *memorySessions) RevokeAllSessions(int, string) error {
+	return nil
+}
+
+func (store *memorySessions) GetUserSessions(int) ([]models.Session, error) {
+	return store.sessions, nil
+}
+
+func (store *memorySessions) SetPendingSession(_ *http.ResponseWriter, _ string, userID int) error {
+	store.pendingSessions = append(store.pendingSessions, userID)
+
+	return nil
+}
+
+func (store *memorySessions) GetPendingSession(*http.Request, string) (int, error) {
+	return 0, models.ErrSessionNotFound
+}
+
+func (store *memorySessions) DeletePendingSession(*http.ResponseWriter, *http.Request, string) error {
+	return nil
+}
+
+func (store *memorySessions) SetOIDCState(_ *http.ResponseWriter, _ string, state models.OIDCState) (string, error) {
+	token, err := models.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	store.states[token] = state
+
+	return token, nil
+}
+
+func (store *memorySessions) TakeOIDCState(
+	_ *http.ResponseWriter,
+	_ *http.Request,
+	_ string,
+	stateToken string,
+) (models.OIDCState, error) {
+	state, found := store.states[stateToken]
+	if !found {
+		return models.OIDCState{}, models.ErrInvalidOIDCState
+	}
+
+	delete(store.states, stateToken)
+
+	return state, nil
+}
+
+// identityUsers logs in the users of the fake provider by their subject and
+// links new subjects to the user that asks for it.
+type identityUsers map[string]models.User
+
+func (users identityUsers) LoginWithIdentity(identity models.ExternalIdentity) (models.User, error) {
+	user, found := users[identity.Subject]
+	if !found {
+		return models.User{}, models.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (users identityUsers) LinkIdentity(userID int, identity models.ExternalIdentity) error {
+	if _, found := users[identity.Subject]; found {
+		return models.ErrIdentityAlreadyLinked
+	}
+
+	users[identity.Subject] = models.User{ID: userID}
+
+	return nil
+}
+
+func (users identityUsers) GetUserIdentities(int) ([]models.LinkedIdentity, error) {
+	return nil, nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	users := identityUsers{
+		"alice": {ID: 1, Login: "alice"},
+		"bob":   {ID: 2, Login: "bob", TOTPEnabled: true},
+	}
+
+	tests := []struct {
+		name            string
+		subject         string
+		nonce           string
+		callbackQuery   func(query url.Values)
+		wantStatus      int
+		wantLocation    string
+		wantTemplate    string
+		wantSession     int
+		wantPendingUser int
+	}{
+		{
+			name:         "user without two-factor authentication",
+			subject:      "alice",
+			wantStatus:   http.StatusFound,
+			wantLocation: "/",
+			wantSession:  1,
+		},
+		{
+			name:            "user with two-factor authentication",
+			subject:         "bob",
+			wantStatus:      http.StatusOK,
+			wantTemplate:    "login-2fa-page",
+			wantPendingUser: 2,
+		},
+		{
+			name:         "unknown user",
+			subject:      "mallory",
+			wantStatus:   http.StatusBadRequest,
+			wantTemplate: "oidc-error-page",
+		},
+		{
+			name:         "id_token for another login",
+			subject:      "alice",
+			nonce:        "replayed-nonce",
+			wantStatus:   http.StatusBadRequest,
+			wantTemplate: "oidc-error-page",
+		},
+		{
+			name:    "forged state",
+			subject: "alice",
+			callbackQuery: func(query url.Values) {
+				query.Set("state", "forged")
+			},
+			wantStatus:   http.StatusBadRequest,
+			wantTemplate: "oidc-error-page",
+		},
+		{
+			name:    "provider refused the login",
+			subject: "alice",
+			callbackQuery: func(query url.Values) {
+				query.Del("code")
+				query.Set("error", "access_denied")
+			},
+			wantStatus:   http.StatusBadRequest,
+			wantTemplate: "oidc-error-page",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newFakeIdP(t, test.subject)
+			idp.nonce = test.nonce
+
+			sessions := newMemorySessions()
+			renderer := &testRenderer{}
+			server := newOIDCServer(t, idp, sessions, users, renderer)
+
+			callbackURL := loginWithFakeIdP(t, server, http.MethodGet, "/login/oidc/fake")
+
+			query := callbackURL.Query()
+			if test.callbackQuery != nil {
+				test.callbackQuery(query)
+			}
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder,
+				httptest.NewRequest(http.MethodGet, callbackURL.Path+"?"+query.Encode(), nil))
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, test.wantStatus)
+			}
+
+			if location := recorder.Header().Get("Location"); location != test.wantLocation {
+				t.Errorf("Location = %q, want %q", location, test.wantLocation)
+			}
+
+			if renderer.name != test.wantTemplate {
+				t.Errorf("rendered %q, want %q", renderer.name, test.wantTemplate)
+			}
+
+			if test.wantSession != 0 &&
+				(len(sessions.sessions) != 1 || sessions.sessions[0].UserID != test.wantSession) {
+				t.Errorf("sessions = %+v, want one for user %d", sessions.sessions, test.wantSession)
+			}
+
+			if test.wantSession == 0 && len(sessions.sessions) != 0 {
+				t.Errorf("sessions = %+v, want none", sessions.sessions)
+			}
+
+			if test.wantPendingUser != 0 &&
+				(len(sessions.pendingSessions) != 1 || sessions.pendingSessions[0] != test.wantPendingUser) {
+				t.Errorf("pending sessions = %v, want one for user %d", sessions.pendingSessions, test.wantPendingUser)
+			}
+
+			if test.wantPendingUser == 0 && len(sessions.pendingSessions) != 0 {
+				t.Errorf("pending sessions = %v, want none", sessions.pendingSessions)
+			}
+		})
+	}
+}
+
+func TestOIDCLinkIdentity(t *testing.T) {
+	tests := []struct {
+		name           string
+		subject        string
+		signedInUserID int
+		wantStatus     int
+		wantLocation   string
+		wantTemplate   string
+		wantLinkedTo   int
+	}{
+		{
+			name:           "new identity",
+			subject:        "carol",
+			signedInUserID: 1,
+			wantStatus:     http.StatusFound,
+			wantLocation:   "/settings",
+			wantLinkedTo:   1,
+		},
+		{
+			name:           "identity linked to another user",
+			subject:        "bob",
+			signedInUserID: 1,
+			wantStatus:     http.StatusBadRequest,
+			wantTemplate:   "oidc-error-page",
+			wantLinkedTo:   2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			users := identityUsers{
+				"alice": {ID: 1, Login: "alice"},
+				"bob":   {ID: 2, Login: "bob"},
+			}
+
+			sessions := newMemorySessions()
+			sessions.signedInUserID = test.signedInUserID
+			renderer := &testRenderer{}
+			server := newOIDCServer(t, newFakeIdP(t, test.subject), sessions, users, renderer)
+
+			callbackURL := loginWithFakeIdP(t, server, http.MethodPost, "/settings/identities/fake")
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, callbackURL.String(), nil))
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, test.wantStatus)
+			}
+
+			if location := recorder.Header().Get("Location"); location != test.wantLocation {
+				t.Errorf("Location = %q, want %q", location, test.wantLocation)
+			}
+
+			if renderer.name != test.wantTemplate {
+				t.Errorf("rendered %q, want %q", renderer.name, test.wantTemplate)
+			}
+
+			if linked := users[test.subject].ID; linked != test.wantLinkedTo {
+				t.Errorf("%q is linked to user %d, want %d", test.subject, linked, test.wantLinkedTo)
+			}
+
+			if len(sessions.sessions) != 0 {
+				t.Errorf("sessions = %+v, want none", sessions.sessions)
+			}
+		})
+	}
+}
+
+// newOIDCServer registers the login and linking routes the way getServer does,
+// with the fake provider as the only identity provider.
+func newOIDCServer(
+	t *testing.T,
+	idp *fakeIdP,
+	sessions *memorySessions,
+	users identityUsers,
+	renderer echo.Renderer,
+) *echo.Echo {
+	t.Helper()
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.ProviderConfig{
+		Name:        "fake",
+		IssuerURL:   idp.server.URL,
+		ClientID:    fakeIdPClientID,
+		RedirectURL: "http://todolist.test/login/oidc/fake/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := echo.New()
+	server.Renderer = renderer
+	providers := map[string]OIDCProvider{"fake": provider}
+	log := discardLogger()
+
+	server.GET("/login/oidc/:provider", OIDCLoginHandler(sessions, providers, log))
+	server.POST("/settings/identities/:provider", LinkIdentityHandler(sessions, sessions, providers, log))
+	server.GET("/login/oidc/:provider/callback",
+		OIDCCallbackHandler(sessions, sessions, users, providers, log))
+
+	return server
+}
+
+// loginWithFakeIdP starts a login or a link with the request and follows the
+// redirect to the provider, returning the callback URL the provider sends the
+// browser back to.
+func loginWithFakeIdP(t *testing.T, server *echo.Echo, method, target string) *url.URL {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("login: status = %d, want %d", recorder.Code, http.StatusFound)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	response, err := client.Get(recorder.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	callbackURL, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return callbackURL
+}
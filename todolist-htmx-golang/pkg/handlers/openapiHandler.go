@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func OpenAPIHandler(document any) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, document)
+	}
+}
+
+func APIDocsHandler(log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		log.Info("GET /api/docs")
+
+		return ctx.Render(http.StatusOK, "api-docs-page", nil)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/mailer"
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+type PasswordResetter interface {
+	GetUserWithLogin(login string) (models.User, error)
+	CreatePasswordResetToken(userID int) (string, error)
+	CheckPasswordResetToken(token string) error
+	ResetPassword(token, newPassword string) (int, error)
+}
+
+type ForgotPasswordFormResponse struct {
+	LoginValue string
+	Sent       bool
+}
+
+type ResetPasswordFormResponse struct {
+	Token string
+	Error string
+	Done  bool
+}
+
+func ForgotPasswordPageHandler(log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		log.Info("GET /forgot-password")
+
+		return ctx.Render(http.StatusOK, "forgot-password-page", ForgotPasswordFormResponse{})
+	}
+}
+
+// ForgotPasswordHandler always answers the same way, so the form can't be used
+// to find out which logins exist.
+func ForgotPasswordHandler(
+	resetter PasswordResetter,
+	mail mailer.Mailer,
+	baseURL string,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		login := ctx.FormValue("login")
+
+		log.Info("POST /forgot-password", "login", login)
+
+		response := ForgotPasswordFormResponse{LoginValue: login, Sent: true}
+
+		user, err := resetter.GetUserWithLogin(login)
+		if err != nil {
+			if !errors.Is(err, models.ErrUserNotFound) {
+				log.Error("failed to get user by login", "err", err)
+			}
+
+			return ctx.Render(http.StatusOK, "forgot-password-form", response)
+		}
+
+		recipient, hasRecipient := passwordResetRecipient(user)
+		if !hasRecipient {
+			log.Info("no address to send a reset link to", "login", login)
+
+			return ctx.Render(http.StatusOK, "forgot-password-form", response)
+		}
+
+		token, err := resetter.CreatePasswordResetToken(user.ID)
+		if err != nil {
+			log.Error("failed to create a reset token", "err", err)
+
+			return ctx.Render(http.StatusOK, "forgot-password-form", response)
+		}
+
+		link := baseURL + "/reset-password?token=" + url.QueryEscape(token)
+
+		err = mail.Send(mailer.Message{
+			To:      recipient,
+			Subject: "Reset your password",
+			Body: "Someone asked to reset the password of your account " + user.Login + ".\n\n" +
+				"Open this link within an hour to choose a new password:\n" + link + "\n\n" +
+				"If it wasn't you, ignore this mail.\n",
+		})
+		if err != nil {
+			log.Error("failed to send a reset link", "err", err)
+		}
+
+		return ctx.Render(http.StatusOK, "forgot-password-form", response)
+	}
+}
+
+func ResetPasswordPageHandler(resetter PasswordResetter, log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		log.Info("GET /reset-password")
+
+		token := ctx.QueryParam("token")
+
+		response := ResetPasswordFormResponse{Token: token}
+
+		err := resetter.CheckPasswordResetToken(token)
+		if errors.Is(err, models.ErrInvalidResetToken) {
+			response.Error = err.Error()
+		} else if err != nil {
+			log.Error("failed to check a reset token", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to check a reset link")
+		}
+
+		return ctx.Render(http.StatusOK, "reset-password-page", response)
+	}
+}
+
+func ResetPasswordHandler(
+	sessionStore SessionStore,
+	resetter PasswordResetter,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		token := ctx.FormValue("token")
+		newPassword := ctx.FormValue("new_password")
+
+		response := ResetPasswordFormResponse{Token: token}
+
+		if newPassword != ctx.FormValue("confirm_password") {
+			response.Error = "Passwords don't match"
+
+			return ctx.Render(http.StatusOK, "reset-password-form", response)
+		}
+
+		userID, err := resetter.ResetPassword(token, newPassword)
+		if errors.Is(err, models.ErrInvalidResetToken) || errors.Is(err, models.ErrEmptyPassword) {
+			response.Error = err.Error()
+
+			return ctx.Render(http.StatusOK, "reset-password-form", response)
+		}
+
+		if err != nil {
+			log.Error("failed to reset a password", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to reset a password")
+		}
+
+		err = sessionStore.RevokeAllSessions(userID, "")
+		if err != nil {
+			log.Error("failed to revoke sessions", "err", err)
+		}
+
+		log.Info("POST /reset-password", "userID", userID)
+
+		return ctx.Render(http.StatusOK, "reset-password-form", ResetPasswordFormResponse{Done: true})
+	}
+}
+
+// passwordResetRecipient returns where to send a reset link. Only a verified
+// address is used, so a typo at registration can't hand the account to someone.
+func passwordResetRecipient(user models.User) (string, bool) {
+	if user.Email == "" || !user.EmailVerified {
+		return "", false
+	}
+
+	return user.Email, true
+}
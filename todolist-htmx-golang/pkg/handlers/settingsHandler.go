@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+type PasswordChanger interface {
+	ChangePassword(userID int, oldPassword, newPassword string) error
+}
+
+type TimeZoneSetter interface {
+	SetTimeZone(userID int, timeZone string) error
+}
+
+type AutoCompleteSetter interface {
+	SetAutoCompleteTasks(userID int, autoComplete bool) error
+}
+
+func SettingsPageHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(session.UserID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		return ctx.Render(http.StatusOK, "settings-page", models.NewSettingsPage(user))
+	}
+}
+
+func ChangePasswordHandler(
+	sessionStore SessionStore,
+	passwordChanger PasswordChanger,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		oldPassword := ctx.FormValue("old_password")
+		newPassword := ctx.FormValue("new_password")
+		confirmPassword := ctx.FormValue("confirm_password")
+
+		formData := models.NewFormData()
+
+		if newPassword != confirmPassword {
+			formData.Errors["ConfirmPassword"] = "Passwords don't match"
+
+			return ctx.Render(http.StatusOK, "change-password-form", formData)
+		}
+
+		err = passwordChanger.ChangePassword(session.UserID, oldPassword, newPassword)
+
+		switch {
+		case errors.Is(err, models.ErrBadPassword):
+			formData.Errors["OldPassword"] = "Wrong password"
+
+			return ctx.Render(http.StatusOK, "change-password-form", formData)
+		case errors.Is(err, models.ErrEmptyPassword):
+			formData.Errors["NewPassword"] = "Password can't be empty"
+
+			return ctx.Render(http.StatusOK, "change-password-form", formData)
+		case err != nil:
+			log.Error("failed to change a password", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to change a password")
+		}
+
+		err = sessionStore.RevokeAllSessions(session.UserID, session.ID)
+		if err != nil {
+			log.Error("failed to revoke other sessions", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to revoke other sessions")
+		}
+
+		log.Info("POST /settings/password", "userID", session.UserID)
+
+		formData.Values["Message"] = "Password changed, other sessions were signed out"
+
+		return ctx.Render(http.StatusOK, "change-password-form", formData)
+	}
+}
+
+func ChangeTimeZoneHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	timeZoneSetter TimeZoneSetter,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(session.UserID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		page := models.NewSettingsPage(user)
+		timeZone := ctx.FormValue("time_zone")
+
+		err = timeZoneSetter.SetTimeZone(user.ID, timeZone)
+		if errors.Is(err, models.ErrInvalidTimeZone) {
+			page.TimeZoneForm.Values["TimeZone"] = timeZone
+			page.TimeZoneForm.Errors["TimeZone"] = "Unknown time zone, use a name like Europe/Berlin"
+
+			return ctx.Render(http.StatusOK, "time-zone-settings", page)
+		}
+
+		if err != nil {
+			log.Error("failed to change a time zone", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to change a time zone")
+		}
+
+		log.Info("POST /settings/timezone", "userID", user.ID)
+
+		page.User.TimeZone = timeZone
+		page.TimeZoneForm.Values["Message"] = "Due dates are now shown in " + timeZone
+
+		return ctx.Render(http.StatusOK, "time-zone-settings", page)
+	}
+}
+
+// ChangeTaskSettingsHandler turns on or off completing a task once every item
+// of its checklist is done.
+func ChangeTaskSettingsHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	autoCompleteSetter AutoCompleteSetter,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(session.UserID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		autoComplete := ctx.FormValue("auto_complete") != ""
+
+		err = autoCompleteSetter.SetAutoCompleteTasks(user.ID, autoComplete)
+		if err != nil {
+			log.Error("failed to change task settings", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to change task settings")
+		}
+
+		log.Info("POST /settings/tasks", "userID", user.ID)
+
+		page := models.NewSettingsPage(user)
+		page.User.AutoCompleteTasks = autoComplete
+		page.TasksForm.Values["Message"] = "Task settings saved"
+
+		return ctx.Render(http.StatusOK, "task-settings", page)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+// ShareListHandler shares a list with the user whose login is sent, or changes
+// the role of a member, and shows the members of the list again.
+func ShareListHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		listID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return listErrorResponse(ctx, log, errInvalidListID)
+		}
+
+		login := ctx.FormValue("login")
+
+		log.Info("POST /lists/:id/members", "userID", user.ID, "listID", listID)
+
+		role, err := models.ParseListRole(ctx.FormValue("role"))
+		if err == nil {
+			_, err = user.ShareList(listID, login, role)
+		}
+
+		formField, message := shareErrorField(err)
+		if formField == "" && err != nil {
+			return listErrorResponse(ctx, log, err)
+		}
+
+		membersForm, err := listMembersForm(user, listID)
+		if err != nil {
+			return listErrorResponse(ctx, log, err)
+		}
+
+		if formField != "" {
+			membersForm.Form.Values["Login"] = login
+			membersForm.Form.Values["Role"] = ctx.FormValue("role")
+			membersForm.Form.Errors[formField] = message
+		}
+
+		return ctx.Render(http.StatusOK, "list-members", membersForm)
+	}
+}
+
+// RemoveListMemberHandler revokes the access of a member to a list. A member
+// who leaves a list is sent back to the Inbox.
+func RemoveListMemberHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		listID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return listErrorResponse(ctx, log, errInvalidListID)
+		}
+
+		memberID, err := strconv.Atoi(ctx.Param("user_id"))
+		if err != nil {
+			return detailErrorResponse(ctx, http.StatusBadRequest, "User id must be a number")
+		}
+
+		log.Info("DELETE /lists/:id/members/:user_id", "userID", user.ID, "listID", listID, "memberID", memberID)
+
+		err = user.RemoveListMember(listID, memberID)
+		if err != nil {
+			return listErrorResponse(ctx, log, err)
+		}
+
+		if memberID == user.ID {
+			ctx.Response().Header().Set("HX-Redirect", "/")
+
+			return ctx.NoContent(http.StatusOK)
+		}
+
+		membersForm, err := listMembersForm(user, listID)
+		if err != nil {
+			return listErrorResponse(ctx, log, err)
+		}
+
+		return ctx.Render(http.StatusOK, "list-members", membersForm)
+	}
+}
+
+func listMembersForm(user models.User, listID int) (models.ListMembersForm, error) {
+	list, err := user.GetList(listID)
+	if err != nil {
+		return models.ListMembersForm{}, err
+	}
+
+	members, err := user.GetListMembers(listID)
+	if err != nil {
+		return models.ListMembersForm{}, err
+	}
+
+	return models.NewListMembersForm(list, members, user.ID), nil
+}
+
+// shareErrorField names the field of the share form an error is about, with
+// the message to show there, or returns an empty field for other errors.
+func shareErrorField(err error) (string, string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidListRole):
+		return "Role", err.Error()
+	case errors.Is(err, models.ErrUserNotFound):
+		return "Login", "No user has this login"
+	case errors.Is(err, models.ErrCannotShareWithOwner):
+		return "Login", err.Error()
+	default:
+		return "", ""
+	}
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+// CreateSubtaskHandler adds an item with the title field to the checklist of a
+// task.
+func CreateSubtaskHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			log.Error("Invalid id", "err", err)
+
+			return badTaskIDResponse(ctx)
+		}
+
+		log.Info("POST /task/:id/subtasks", "id", taskID)
+
+		title := ctx.FormValue("title")
+
+		_, err = user.AddSubtask(taskID, title)
+		if isSubtaskValidationError(err) {
+			if wantsJSON(ctx) {
+				return problemResponse(ctx, ProblemDetails{
+					Status: http.StatusUnprocessableEntity,
+					Title:  "Checklist item is invalid",
+					Errors: map[string]string{"title": err.Error()},
+				})
+			}
+
+			task, getErr := user.GetTaskByID(taskID)
+			if getErr != nil {
+				return taskErrorResponse(ctx, log, getErr)
+			}
+
+			subtasksForm := models.NewSubtasksForm(task)
+			subtasksForm.Open = true
+			subtasksForm.Form.Values["Title"] = title
+			subtasksForm.Form.Errors["Title"] = err.Error()
+
+			return ctx.Render(http.StatusOK, "task-subtasks", subtasksForm)
+		}
+
+		if err != nil {
+			return subtaskErrorResponse(ctx, log, err)
+		}
+
+		return subtasksResponse(ctx, log, user, taskID)
+	}
+}
+
+// ToggleSubtaskHandler checks or unchecks an item of the checklist of a task,
+// which can complete the task too.
+func ToggleSubtaskHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			log.Error("Invalid id", "err", err)
+
+			return badTaskIDResponse(ctx)
+		}
+
+		subtaskID, err := strconv.Atoi(ctx.Param("subtask_id"))
+		if err != nil {
+			return detailErrorResponse(ctx, http.StatusBadRequest, "Checklist item id must be a number")
+		}
+
+		log.Info("PUT /task/:id/subtasks/:subtask_id", "id", taskID, "subtaskID", subtaskID)
+
+		task, err := user.GetTaskByID(taskID)
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		isDone, found := subtaskDoneStatus(task, subtaskID)
+		if !found {
+			return subtaskErrorResponse(ctx, log, models.ErrSubtaskNotFound)
+		}
+
+		err = user.SetSubtaskDoneStatus(taskID, subtaskID, !isDone)
+		if err != nil {
+			return subtaskErrorResponse(ctx, log, err)
+		}
+
+		return subtasksResponse(ctx, log, user, taskID)
+	}
+}
+
+// RemoveSubtaskHandler deletes an item from the checklist of a task.
+func RemoveSubtaskHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			log.Error("Invalid id", "err", err)
+
+			return badTaskIDResponse(ctx)
+		}
+
+		subtaskID, err := strconv.Atoi(ctx.Param("subtask_id"))
+		if err != nil {
+			return detailErrorResponse(ctx, http.StatusBadRequest, "Checklist item id must be a number")
+		}
+
+		log.Info("DELETE /task/:id/subtasks/:subtask_id", "id", taskID, "subtaskID", subtaskID)
+
+		err = user.RemoveSubtask(taskID, subtaskID)
+		if err != nil {
+			return subtaskErrorResponse(ctx, log, err)
+		}
+
+		return subtasksResponse(ctx, log, user, taskID)
+	}
+}
+
+// subtasksResponse answers a change to a checklist with the task, or with the
+// expanded checklist for htmx, which also updates the title of the task in
+// case it was completed.
+func subtasksResponse(ctx echo.Context, log *slog.Logger, user models.User, taskID int) error {
+	task, err := user.GetTaskByID(taskID)
+	if err != nil {
+		return taskErrorResponse(ctx, log, err)
+	}
+
+	if wantsJSON(ctx) {
+		return ctx.JSON(http.StatusOK, task)
+	}
+
+	subtasksForm := models.NewSubtasksForm(task)
+	subtasksForm.Open = true
+
+	return ctx.Render(http.StatusOK, "task-subtasks", subtasksForm)
+}
+
+func subtaskDoneStatus(task models.Task, subtaskID int) (bool, bool) {
+	for _, subtask := range task.Subtasks {
+		if subtask.ID == subtaskID {
+			return subtask.IsDone, true
+		}
+	}
+
+	return false, false
+}
+
+func isSubtaskValidationError(err error) bool {
+	return errors.Is(err, models.ErrEmptySubtaskTitle) || errors.Is(err, models.ErrSubtaskTitleTooLong)
+}
+
+func subtaskErrorResponse(ctx echo.Context, log *slog.Logger, err error) error {
+	if errors.Is(err, models.ErrSubtaskNotFound) {
+		log.Info("Checklist item not found", "err", err)
+
+		return detailErrorResponse(ctx, http.StatusNotFound, "Checklist item is not found")
+	}
+
+	return taskErrorResponse(ctx, log, err)
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+func TagsPageHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		tags, err := user.GetTags()
+		if err != nil {
+			log.Error("failed to get tags", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get tags")
+		}
+
+		return ctx.Render(http.StatusOK, "tags-page", models.NewTagsPage(user, tags))
+	}
+}
+
+func CreateTagHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		name := ctx.FormValue("name")
+
+		formData := models.NewFormData()
+
+		_, err = user.CreateTag(name)
+
+		switch {
+		case errors.Is(err, models.ErrInvalidTagName), errors.Is(err, models.ErrTagAlreadyExist):
+			formData.Values["Name"] = name
+			formData.Errors["Name"] = err.Error()
+		case err != nil:
+			log.Error("failed to create a tag", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "Failed to create a tag")
+		}
+
+		log.Info("POST /tags", "userID", user.ID)
+
+		tags, err := user.GetTags()
+		if err != nil {
+			log.Error("failed to get tags", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get tags")
+		}
+
+		page := models.NewTagsPage(user, tags)
+		page.Form = formData
+
+		return ctx.Render(http.StatusOK, "tags", page)
+	}
+}
+
+// UpdateTagHandler renames and recolors a tag, and answers with its row on the
+// tags page.
+func UpdateTagHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		tagID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return detailErrorResponse(ctx, http.StatusBadRequest, "Invalid id")
+		}
+
+		log.Info("PATCH /tags/:id", "userID", user.ID, "tagID", tagID)
+
+		name := ctx.FormValue("name")
+		color := ctx.FormValue("color")
+
+		tag, err := user.UpdateTag(tagID, name, color)
+
+		tagForm := models.NewTagForm(tag)
+
+		switch {
+		case errors.Is(err, models.ErrInvalidTagName), errors.Is(err, models.ErrTagAlreadyExist):
+			tagForm.Tag = models.Tag{ID: tagID, Name: name, Color: color}
+			tagForm.Form.Errors["Name"] = err.Error()
+		case errors.Is(err, models.ErrInvalidTagColor):
+			tagForm.Tag = models.Tag{ID: tagID, Name: name, Color: color}
+			tagForm.Form.Errors["Color"] = err.Error()
+		case errors.Is(err, models.ErrTagNotFound):
+			return detailErrorResponse(ctx, http.StatusNotFound, "Tag is not found")
+		case err != nil:
+			log.Error("failed to update a tag", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "Failed to update a tag")
+		}
+
+		return ctx.Render(http.StatusOK, "tag", tagForm)
+	}
+}
+
+func DeleteTagHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		tagID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return detailErrorResponse(ctx, http.StatusBadRequest, "Invalid id")
+		}
+
+		log.Info("DELETE /tags/:id", "userID", user.ID, "tagID", tagID)
+
+		err = user.DeleteTag(tagID)
+		if errors.Is(err, models.ErrTagNotFound) {
+			return detailErrorResponse(ctx, http.StatusNotFound, "Tag is not found")
+		}
+
+		if err != nil {
+			log.Error("failed to delete a tag", "err", err)
+
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "Failed to delete a tag")
+		}
+
+		return ctx.NoContent(http.StatusOK)
+	}
+}
+
+// RemoveTaskTagHandler takes a tag off a task; the tag itself stays.
+func RemoveTaskTagHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			log.Error("Invalid id", "err", err)
+
+			return badTaskIDResponse(ctx)
+		}
+
+		tagID, err := strconv.Atoi(ctx.Param("tag_id"))
+		if err != nil {
+			return detailErrorResponse(ctx, http.StatusBadRequest, "Tag id must be a number")
+		}
+
+		log.Info("DELETE /task/:id/tags/:tag_id", "id", taskID, "tagID", tagID)
+
+		err = user.RemoveTaskTag(taskID, tagID)
+		if errors.Is(err, models.ErrTagNotFound) {
+			return detailErrorResponse(ctx, http.StatusNotFound, "Task doesn't have the tag")
+		}
+
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		task, err := user.GetTaskByID(taskID)
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		if wantsJSON(ctx) {
+			return ctx.JSON(http.StatusOK, task)
+		}
+
+		return ctx.Render(http.StatusOK, "task", task)
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+// TaskDescriptionHandler renders the description panel of a task, which is
+// how the editor is closed without saving.
+func TaskDescriptionHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			log.Error("Invalid id", "err", err)
+
+			return badTaskIDResponse(ctx)
+		}
+
+		task, err := user.GetTaskByID(taskID)
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		return ctx.Render(http.StatusOK, "task-description", task)
+	}
+}
+
+func EditTaskDescriptionHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			log.Error("Invalid id", "err", err)
+
+			return badTaskIDResponse(ctx)
+		}
+
+		task, err := user.GetTaskByID(taskID)
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		if !task.CanEdit {
+			return taskErrorResponse(ctx, log, models.ErrPermissionDenied)
+		}
+
+		taskForm := models.NewTaskForm(task)
+		taskForm.Form.Values["Description"] = task.Description
+
+		return ctx.Render(http.StatusOK, "task-description-form", taskForm)
+	}
+}
+
+func UpdateTaskDescriptionHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			log.Error("Invalid id", "err", err)
+
+			return badTaskIDResponse(ctx)
+		}
+
+		update, err := taskUpdateFromBody(ctx, user.Location())
+		if err != nil {
+			return badRequestBodyResponse(ctx, err)
+		}
+
+		description := stringValue(update.Description)
+
+		log.Info("PUT /task/:id/description", "id", taskID)
+
+		task, err := user.UpdateTask(taskID, models.TaskUpdate{Description: &description})
+		if isTaskValidationError(err) {
+			if wantsJSON(ctx) {
+				return taskValidationResponse(ctx, err)
+			}
+
+			taskForm := models.NewTaskForm(models.Task{ID: taskID})
+			taskForm.Form.Values["Description"] = description
+			taskForm.Form.Errors["Description"] = err.Error()
+
+			return ctx.Render(http.StatusOK, "task-description-form", taskForm)
+		}
+
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		if wantsJSON(ctx) {
+			return ctx.JSON(http.StatusOK, task)
+		}
+
+		return ctx.Render(http.StatusOK, "task-description", task)
+	}
+}
+
+// PreviewMarkdownHandler renders a description the way it will look once it
+// is saved, without saving it.
+func PreviewMarkdownHandler(log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		_, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		return ctx.Render(http.StatusOK, "markdown-preview", ctx.FormValue("description"))
+	}
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
@@ -12,59 +15,56 @@ import (
 )
 
 type UserStorage interface {
-	GetUserWithLogin(login string) (models.User, error)
+	GetUserWithID(userID int) (models.User, error)
 }
 
 func ToggleDoneStatusTaskHandler(
-	sessionStore SessionStore,
 	userStorage UserStorage,
 	log *slog.Logger,
 ) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
-		login, err := sessionStore.GetSession(ctx.Request(), "session")
-		if err != nil {
-			log.Info("Not authorized! Redirecting...", "err", err)
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
 
 			return ctx.Redirect(http.StatusFound, "/login")
 		}
 
-		user, err := userStorage.GetUserWithLogin(login)
+		user, err := userStorage.GetUserWithID(userID)
 		if err != nil {
-			log.Error("failed to get a user with login", "err", err)
+			log.Error("failed to get a user with id", "err", err)
 
-			return ctx.String(http.StatusInternalServerError, "Invalid id")
+			return taskErrorResponse(ctx, log, err)
 		}
 
 		taskID, err := strconv.Atoi(ctx.Param("id"))
 		if err != nil {
 			log.Error("Invalid id", "err", err)
 
-			return ctx.String(http.StatusBadRequest, "Invalid id")
+			return badTaskIDResponse(ctx)
 		}
 
 		log.Info("PUT /task/:id", "id", taskID)
 
 		task, err := user.GetTaskByID(taskID)
 		if err != nil {
-			log.Error("Task not found", "err", err)
-
-			return ctx.String(http.StatusNotFound, "Task is not found")
+			return taskErrorResponse(ctx, log, err)
 		}
 
 		newDoneStatus := !task.IsDone
 
 		err = user.SetDoneStatus(taskID, newDoneStatus)
 		if err != nil {
-			log.Error("Task not found", "err", err)
-
-			return ctx.String(http.StatusNotFound, "Task is not found")
+			return taskErrorResponse(ctx, log, err)
 		}
 
 		updatedTask, err := user.GetTaskByID(taskID)
 		if err != nil {
-			log.Error("failed to get a task", "err", err)
+			return taskErrorResponse(ctx, log, err)
+		}
 
-			return ctx.String(http.StatusNotFound, "Task is not found")
+		if wantsJSON(ctx) {
+			return ctx.JSON(http.StatusOK, updatedTask)
 		}
 
 		return ctx.Render(http.StatusOK, "task", updatedTask)
@@ -72,39 +72,40 @@ func ToggleDoneStatusTaskHandler(
 }
 
 func RemoveTaskHandler(
-	sessionStore SessionStore,
 	userStorage UserStorage,
 	log *slog.Logger,
 ) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
-		login, err := sessionStore.GetSession(ctx.Request(), "session")
-		if err != nil {
-			log.Info("Not authorized! Redirecting...", "err", err)
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
 
 			return ctx.Redirect(http.StatusFound, "/login")
 		}
 
-		user, err := userStorage.GetUserWithLogin(login)
+		user, err := userStorage.GetUserWithID(userID)
 		if err != nil {
-			log.Error("failed to get a user with login", "err", err)
+			log.Error("failed to get a user with id", "err", err)
 
-			return ctx.String(http.StatusInternalServerError, "Invalid id")
+			return taskErrorResponse(ctx, log, err)
 		}
 
 		taskID, err := strconv.Atoi(ctx.Param("id"))
 		if err != nil {
 			log.Error("Invalid id", "err", err)
 
-			return ctx.String(http.StatusBadRequest, "Invalid id")
+			return badTaskIDResponse(ctx)
 		}
 
 		log.Info("DELETE /task/:id", "id", taskID)
 
 		err = user.RemoveTask(taskID)
 		if err != nil {
-			log.Error("Task not found", "err", err)
+			return taskErrorResponse(ctx, log, err)
+		}
 
-			return ctx.String(http.StatusNotFound, "Task is not found")
+		if wantsJSON(ctx) {
+			return ctx.NoContent(http.StatusNoContent)
 		}
 
 		return ctx.NoContent(http.StatusOK)
@@ -112,33 +113,54 @@ func RemoveTaskHandler(
 }
 
 func CreateTaskHandler(
-	sessionStore SessionStore,
 	userStorage UserStorage,
 	log *slog.Logger,
 ) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
-		login, err := sessionStore.GetSession(ctx.Request(), "session")
-		if err != nil {
-			log.Info("Not authorized! Redirecting...", "err", err)
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
 
 			return ctx.Redirect(http.StatusFound, "/login")
 		}
 
-		user, err := userStorage.GetUserWithLogin(login)
+		user, err := userStorage.GetUserWithID(userID)
 		if err != nil {
-			log.Error("failed to get a user with login", "err", err)
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
 
-			return ctx.String(http.StatusInternalServerError, "Invalid id")
+		update, err := taskUpdateFromBody(ctx, user.Location())
+		if err != nil && !isTaskValidationError(err) {
+			return badRequestBodyResponse(ctx, err)
 		}
 
-		taskTitle := ctx.FormValue("title")
-		isDone := false
+		taskTitle := stringValue(update.Title)
+		task := models.Task{}
+
+		if err == nil {
+			task, err = user.NewTask(models.TaskDraft{
+				Title:       taskTitle,
+				Description: stringValue(update.Description),
+				DueAt:       update.DueAt,
+				Priority:    priorityValue(update.Priority),
+				Tags:        update.AddTags,
+				ListID:      update.ListID,
+			})
+		}
+
+		if errors.Is(err, models.ErrTaskAlreadyExist) || isTaskValidationError(err) {
+			if wantsJSON(ctx) {
+				return taskValidationResponse(ctx, err)
+			}
 
-		task, err := user.NewTask(taskTitle, isDone)
-		if errors.Is(err, models.ErrTaskAlreadyExist) {
 			newFormData := models.NewFormData()
-			newFormData.Values["Title"] = taskTitle
-			newFormData.Errors["Title"] = "Task already exist"
+			newFormData.Values["Title"] = ctx.FormValue("title")
+			newFormData.Values["DueAt"] = ctx.FormValue("due_at")
+			newFormData.Values["Priority"] = ctx.FormValue("priority")
+			newFormData.Values["ListID"] = ctx.FormValue("list_id")
+			newFormData.Errors[taskFormField(err)] = err.Error()
 
 			return ctx.Render(http.StatusOK, "create-task-form", newFormData)
 		}
@@ -146,18 +168,392 @@ func CreateTaskHandler(
 		if err != nil {
 			log.Error("Failed to create a task", "err", err)
 
-			return ctx.String(http.StatusInternalServerError, "Failed to create a task")
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		log.Info("POST /tasks")
+
+		if wantsJSON(ctx) {
+			ctx.Response().Header().Set("Location", "/api/v1/tasks/"+strconv.Itoa(task.ID))
+
+			return ctx.JSON(http.StatusCreated, task)
 		}
 
-		err = ctx.Render(http.StatusOK, "create-task-form", models.NewFormData())
+		newFormData := models.NewFormData()
+		newFormData.Values["ListID"] = ctx.FormValue("list_id")
+
+		err = ctx.Render(http.StatusOK, "create-task-form", newFormData)
 		if err != nil {
 			log.Error("Failed to create a form", "err", err)
 
-			return ctx.String(http.StatusInternalServerError, "Failed to create a task")
+			return detailErrorResponse(ctx, http.StatusInternalServerError, "Failed to create a task")
 		}
 
-		log.Info("POST /tasks")
-
 		return ctx.Render(http.StatusOK, "oob-task", task)
 	}
 }
+
+func GetTaskHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			log.Error("Invalid id", "err", err)
+
+			return badTaskIDResponse(ctx)
+		}
+
+		task, err := user.GetTaskByID(taskID)
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		if wantsJSON(ctx) {
+			return ctx.JSON(http.StatusOK, task)
+		}
+
+		return ctx.Render(http.StatusOK, "task", task)
+	}
+}
+
+func EditTaskHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			log.Error("Invalid id", "err", err)
+
+			return badTaskIDResponse(ctx)
+		}
+
+		task, err := user.GetTaskByID(taskID)
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		if !task.CanEdit {
+			return taskErrorResponse(ctx, log, models.ErrPermissionDenied)
+		}
+
+		taskForm := models.NewTaskForm(task)
+
+		taskForm.Lists, err = user.GetLists()
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		return ctx.Render(http.StatusOK, "task-edit-form", taskForm)
+	}
+}
+
+// UpdateTaskHandler changes the fields of a task it is sent, which the inline
+// editor uses for the title, the due date and the list. A task that moved to
+// another list is taken off the page.
+func UpdateTaskHandler(
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, isAuthenticated := authenticatedUserID(ctx)
+		if !isAuthenticated {
+			log.Info("Not authorized! Redirecting...")
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get a user with id", "err", err)
+
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		taskID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			log.Error("Invalid id", "err", err)
+
+			return badTaskIDResponse(ctx)
+		}
+
+		update, err := taskUpdateFromBody(ctx, user.Location())
+		if err != nil && !isTaskValidationError(err) {
+			return badRequestBodyResponse(ctx, err)
+		}
+
+		log.Info("PATCH /task/:id", "id", taskID)
+
+		if update.ListID != nil || update.MoveToInbox {
+			task, err := user.GetTaskByID(taskID)
+			if err != nil {
+				return taskErrorResponse(ctx, log, err)
+			}
+
+			update = skipUnchangedList(update, task.ListID)
+		}
+
+		task := models.Task{}
+		if err == nil {
+			task, err = user.UpdateTask(taskID, update)
+		}
+
+		if isTaskValidationError(err) {
+			if wantsJSON(ctx) {
+				return taskValidationResponse(ctx, err)
+			}
+
+			taskForm := models.NewTaskForm(models.Task{ID: taskID})
+			taskForm.Form.Values["Title"] = ctx.FormValue("title")
+			taskForm.Form.Values["DueAt"] = ctx.FormValue("due_at")
+			taskForm.Form.Values["ListID"] = ctx.FormValue("list_id")
+			taskForm.Form.Errors[taskFormField(err)] = err.Error()
+
+			taskForm.Lists, err = user.GetLists()
+			if err != nil {
+				return taskErrorResponse(ctx, log, err)
+			}
+
+			return ctx.Render(http.StatusOK, "task-edit-form", taskForm)
+		}
+
+		if err != nil {
+			return taskErrorResponse(ctx, log, err)
+		}
+
+		if wantsJSON(ctx) {
+			return ctx.JSON(http.StatusOK, task)
+		}
+
+		if update.ListID != nil || update.MoveToInbox {
+			return ctx.NoContent(http.StatusOK)
+		}
+
+		return ctx.Render(http.StatusOK, "task", task)
+	}
+}
+
+// taskUpdateFromBody reads the fields of a task from the form, or from a JSON
+// body for clients that send one. Fields that are not sent stay nil, and an
+// empty due_at field removes the due date. Form dates are in the time zone of
+// the user, JSON ones carry their own offset. The #tags of a form title are
+// taken out of it and added to the task, and an empty list_id field moves the
+// task to the Inbox.
+func taskUpdateFromBody(ctx echo.Context, location *time.Location) (models.TaskUpdate, error) {
+	contentType := ctx.Request().Header.Get(echo.HeaderContentType)
+	if strings.HasPrefix(contentType, echo.MIMEApplicationJSON) {
+		request := APITaskRequest{}
+
+		err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+		if err != nil {
+			return models.TaskUpdate{}, err
+		}
+
+		return models.TaskUpdate{
+			Title:       request.Title,
+			IsDone:      request.IsDone,
+			Description: request.Description,
+			DueAt:       request.DueAt,
+			Priority:    request.Priority,
+			AddTags:     request.Tags,
+			ListID:      request.ListID,
+		}, nil
+	}
+
+	update := models.TaskUpdate{}
+
+	form, err := ctx.FormParams()
+	if err != nil {
+		return update, err
+	}
+
+	if form.Has("title") {
+		title, tags := models.ParseTitleTags(form.Get("title"))
+		update.Title = &title
+		update.AddTags = tags
+	}
+
+	if form.Has("description") {
+		description := form.Get("description")
+		update.Description = &description
+	}
+
+	if form.Has("priority") {
+		priority, err := models.ParsePriority(form.Get("priority"))
+		if err != nil {
+			return update, err
+		}
+
+		update.Priority = &priority
+	}
+
+	if form.Has("list_id") {
+		if form.Get("list_id") == "" {
+			update.MoveToInbox = true
+		} else {
+			listID, err := strconv.Atoi(form.Get("list_id"))
+			if err != nil {
+				return update, models.ErrListNotFound
+			}
+
+			update.ListID = &listID
+		}
+	}
+
+	if !form.Has("due_at") {
+		return update, nil
+	}
+
+	if form.Get("due_at") == "" {
+		update.RemoveDueAt = true
+
+		return update, nil
+	}
+
+	dueAt, err := time.ParseInLocation(models.DueAtInputLayout, form.Get("due_at"), location)
+	if err != nil {
+		return update, models.ErrInvalidDueDate
+	}
+
+	update.DueAt = &dueAt
+
+	return update, nil
+}
+
+// skipUnchangedList drops the move from an update that keeps the task in its
+// list, since the inline editor sends the list along with every change.
+func skipUnchangedList(update models.TaskUpdate, listID *int) models.TaskUpdate {
+	if update.MoveToInbox && listID == nil {
+		update.MoveToInbox = false
+	}
+
+	if update.ListID != nil && listID != nil && *update.ListID == *listID {
+		update.ListID = nil
+	}
+
+	return update
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+func priorityValue(value *models.Priority) models.Priority {
+	if value == nil {
+		return models.PriorityNone
+	}
+
+	return *value
+}
+
+func badRequestBodyResponse(ctx echo.Context, err error) error {
+	return problemResponse(ctx, ProblemDetails{
+		Status: http.StatusBadRequest,
+		Detail: "Body must be a form or a JSON task: " + err.Error(),
+	})
+}
+
+// taskValidationResponse answers JSON clients with a 422 problem document that
+// names the invalid field.
+func taskValidationResponse(ctx echo.Context, err error) error {
+	return problemResponse(ctx, ProblemDetails{
+		Status: http.StatusUnprocessableEntity,
+		Title:  "Task is invalid",
+		Errors: map[string]string{taskValidationField(err): err.Error()},
+	})
+}
+
+func badTaskIDResponse(ctx echo.Context) error {
+	return detailErrorResponse(ctx, http.StatusBadRequest, "Task id must be a number")
+}
+
+func taskErrorResponse(ctx echo.Context, log *slog.Logger, err error) error {
+	status := http.StatusInternalServerError
+	message := "Failed to access a task"
+
+	switch {
+	case errors.Is(err, models.ErrTaskNotFound):
+		log.Info("Task not found", "err", err)
+
+		status = http.StatusNotFound
+		message = "Task is not found"
+	case errors.Is(err, models.ErrPermissionDenied):
+		log.Info("Task is read-only", "err", err)
+
+		status = http.StatusForbidden
+		message = "You can only view this task"
+	default:
+		log.Error("failed to access a task", "err", err)
+	}
+
+	return detailErrorResponse(ctx, status, message)
+}
+
+// taskFormField is the FormData key of the field a validation error is about.
+func taskFormField(err error) string {
+	field := taskValidationField(err)
+	if field == "" {
+		return "Title"
+	}
+
+	return strings.ToUpper(field[:1]) + field[1:]
+}
+
+func isTaskValidationError(err error) bool {
+	return taskValidationField(err) != ""
+}
+
+// taskValidationField names the task field a validation error is about, or
+// returns an empty string when err is not a validation error.
+func taskValidationField(err error) string {
+	switch {
+	case errors.Is(err, models.ErrEmptyTaskTitle), errors.Is(err, models.ErrTaskTitleTooLong):
+		return "title"
+	case errors.Is(err, models.ErrTaskDescriptionTooLong):
+		return "description"
+	case errors.Is(err, models.ErrInvalidDueDate):
+		return "dueAt"
+	case errors.Is(err, models.ErrInvalidPriority):
+		return "priority"
+	case errors.Is(err, models.ErrInvalidTagName):
+		return "tags"
+	case errors.Is(err, models.ErrListNotFound), errors.Is(err, models.ErrListArchived):
+		return "listId"
+	default:
+		return ""
+	}
+}
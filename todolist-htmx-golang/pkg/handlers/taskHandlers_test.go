@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+const (
+	testTaskUserID  = 1
+	otherTaskUserID = 2
+)
+
+var errDatabaseDown = errors.New("database is down")
+
+// taskUsers hands out a single user whose queries go to a sqlmock database.
+type taskUsers struct {
+	user models.User
+}
+
+func newTaskUsers(t *testing.T, userID int) (taskUsers, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+
+		db.Close()
+	})
+
+	mock.ExpectPrepare(regexp.QuoteMeta(`SELECT id, login`)).ExpectQuery().
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "login", "password", "totp_enabled", "email", "email_verified", "time_zone", "auto_complete_tasks",
+		}).AddRow(userID, "alice", "", false, "", true, "UTC", true))
+
+	storage := models.GetUserStorage(discardLogger(), db, models.PasswordHasher{})
+
+	user, err := storage.GetUserWithID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return taskUsers{user: user}, mock
+}
+
+func (users taskUsers) GetUserWithID(userID int) (models.User, error) {
+	if userID != users.user.ID {
+		return models.User{}, models.ErrUserNotFound
+	}
+
+	return users.user, nil
+}
+
+func taskRows(taskID int, title string, isDone bool) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"id", "title", "is_done", "description", "due_at", "priority", "created_at", "list_id", "can_edit",
+	}).AddRow(taskID, title, isDone, "", nil, 0, time.Now(), nil, true)
+}
+
+func expectTaskDetails(mock sqlmock.Sqlmock) {
+	mock.ExpectPrepare(regexp.QuoteMeta("SELECT task_tag.task_id")).ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"task_id", "id", "name", "color"}))
+	mock.ExpectPrepare(regexp.QuoteMeta("SELECT task_id, id, title, is_done FROM subtask")).ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"task_id", "id", "title", "is_done"}))
+}
+
+func expectTask(mock sqlmock.Sqlmock, taskID int, isDone bool) {
+	mock.ExpectPrepare(regexp.QuoteMeta("SELECT task.id")).ExpectQuery().
+		WithArgs(taskID, testTaskUserID).
+		WillReturnRows(taskRows(taskID, "Deploy", isDone))
+	expectTaskDetails(mock)
+}
+
+// expectNoTask expects the task to be looked up for the user, who can't see it.
+func expectNoTask(mock sqlmock.Sqlmock, taskID, userID int) {
+	mock.ExpectPrepare(regexp.QuoteMeta("SELECT task.id")).ExpectQuery().
+		WithArgs(taskID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+func expectLists(mock sqlmock.Sqlmock) {
+	mock.ExpectPrepare(regexp.QuoteMeta("ORDER BY task_list.is_archived")).ExpectQuery().
+		WithArgs(testTaskUserID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "name", "is_archived", "created_at", "user_id", "login", "role",
+		}))
+}
+
+// taskHandlerTest is a request to one of the task routes, the queries it is
+// expected to make and the answer it should get. The request is made by
+// testTaskUserID unless userID says otherwise.
+type taskHandlerTest struct {
+	name         string
+	userID       int
+	method       string
+	target       string
+	body         string
+	json         bool
+	expect       func(mock sqlmock.Sqlmock)
+	wantStatus   int
+	wantTemplate string
+	wantBody     string
+}
+
+func runTaskHandlerTests(t *testing.T, tests []taskHandlerTest) {
+	t.Helper()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userID := test.userID
+			if userID == 0 {
+				userID = testTaskUserID
+			}
+
+			users, mock := newTaskUsers(t, userID)
+			if test.expect != nil {
+				test.expect(mock)
+			}
+
+			renderer := &testRenderer{}
+			server := newTaskServer(users, renderer)
+
+			request := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+
+			if test.json {
+				request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				request.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+			}
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+
+			if renderer.name != test.wantTemplate {
+				t.Errorf("rendered %q, want %q", renderer.name, test.wantTemplate)
+			}
+
+			if !strings.Contains(recorder.Body.String(), test.wantBody) {
+				t.Errorf("body %q does not contain %q", recorder.Body, test.wantBody)
+			}
+		})
+	}
+}
+
+// newTaskServer registers the task handlers the way getServer does, with the
+// user already signed in.
+func newTaskServer(users taskUsers, renderer echo.Renderer) *echo.Echo {
+	server := echo.New()
+	server.Renderer = renderer
+	log := discardLogger()
+
+	authenticated := server.Group("", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(userIDContextKey, users.user.ID)
+
+			return next(ctx)
+		}
+	})
+
+	authenticated.GET("/", BaseHandler(users, log))
+	authenticated.PUT("/task/:id", ToggleDoneStatusTaskHandler(users, log))
+	authenticated.PATCH("/task/:id", UpdateTaskHandler(users, log))
+	authenticated.DELETE("/task/:id", RemoveTaskHandler(users, log))
+	authenticated.POST("/tasks", CreateTaskHandler(users, log))
+
+	return server
+}
+
+func TestCreateTaskHandler(t *testing.T) {
+	expectInsert := func(mock sqlmock.Sqlmock) {
+		mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO task(")).ExpectQuery().
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, time.Now()))
+		mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO user_task")).ExpectExec().
+			WithArgs(testTaskUserID, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTaskDetails(mock)
+	}
+
+	runTaskHandlerTests(t, []taskHandlerTest{
+		{
+			name:         "form",
+			method:       http.MethodPost,
+			target:       "/tasks",
+			body:         "title=Deploy",
+			expect:       expectInsert,
+			wantStatus:   http.StatusOK,
+			wantTemplate: "oob-task",
+			wantBody:     "create-task-formoob-task",
+		},
+		{
+			name:       "JSON",
+			method:     http.MethodPost,
+			target:     "/tasks",
+			body:       `{"title": "Deploy"}`,
+			json:       true,
+			expect:     expectInsert,
+			wantStatus: http.StatusCreated,
+			wantBody:   `"title":"Deploy"`,
+		},
+		{
+			name:         "form without a title",
+			method:       http.MethodPost,
+			target:       "/tasks",
+			body:         "title=+",
+			wantStatus:   http.StatusOK,
+			wantTemplate: "create-task-form",
+		},
+		{
+			name:       "JSON without a title",
+			method:     http.MethodPost,
+			target:     "/tasks",
+			body:       `{"title": " "}`,
+			json:       true,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `"title"`,
+		},
+		{
+			name:       "malformed JSON",
+			method:     http.MethodPost,
+			target:     "/tasks",
+			body:       `{"title":`,
+			json:       true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "failing database",
+			method: http.MethodPost,
+			target: "/tasks",
+			body:   "title=Deploy",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO task(")).WillReturnError(errDatabaseDown)
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestUpdateTaskHandler(t *testing.T) {
+	expectUpdate := func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE task SET title")).
+			WithArgs("Ship", nil, nil, false, nil, nil, 7, testTaskUserID, false, nil).
+			WillReturnRows(taskRows(7, "Ship", false))
+		mock.ExpectCommit()
+		expectTaskDetails(mock)
+	}
+
+	runTaskHandlerTests(t, []taskHandlerTest{
+		{
+			name:         "form",
+			method:       http.MethodPatch,
+			target:       "/task/7",
+			body:         "title=Ship",
+			expect:       expectUpdate,
+			wantStatus:   http.StatusOK,
+			wantTemplate: "task",
+		},
+		{
+			name:       "JSON",
+			method:     http.MethodPatch,
+			target:     "/task/7",
+			body:       `{"title": "Ship"}`,
+			json:       true,
+			expect:     expectUpdate,
+			wantStatus: http.StatusOK,
+			wantBody:   `"title":"Ship"`,
+		},
+		{
+			name:         "form without a title",
+			method:       http.MethodPatch,
+			target:       "/task/7",
+			body:         "title=",
+			expect:       expectLists,
+			wantStatus:   http.StatusOK,
+			wantTemplate: "task-edit-form",
+		},
+		{
+			name:   "another user's task",
+			userID: otherTaskUserID,
+			method: http.MethodPatch,
+			target: "/task/7",
+			body:   "title=Ship",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE task SET title")).
+					WithArgs("Ship", nil, nil, false, nil, nil, 7, otherTaskUserID, false, nil).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				expectNoTask(mock, 7, otherTaskUserID)
+				mock.ExpectRollback()
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   "Task is not found",
+		},
+		{
+			name:       "invalid id",
+			method:     http.MethodPatch,
+			target:     "/task/seven",
+			body:       "title=Ship",
+			wantStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestRemoveTaskHandler(t *testing.T) {
+	expectDelete := func(userID int, rowsAffected int64) func(mock sqlmock.Sqlmock) {
+		return func(mock sqlmock.Sqlmock) {
+			mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM task")).ExpectExec().
+				WithArgs(7, userID).
+				WillReturnResult(sqlmock.NewResult(0, rowsAffected))
+		}
+	}
+
+	runTaskHandlerTests(t, []taskHandlerTest{
+		{
+			name:       "HTML",
+			method:     http.MethodDelete,
+			target:     "/task/7",
+			expect:     expectDelete(testTaskUserID, 1),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "JSON",
+			method:     http.MethodDelete,
+			target:     "/task/7",
+			json:       true,
+			expect:     expectDelete(testTaskUserID, 1),
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   "another user's task",
+			userID: otherTaskUserID,
+			method: http.MethodDelete,
+			target: "/task/7",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectDelete(otherTaskUserID, 0)(mock)
+				expectNoTask(mock, 7, otherTaskUserID)
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   "Task is not found",
+		},
+		{
+			name:   "read-only task",
+			method: http.MethodDelete,
+			target: "/task/7",
+			json:   true,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectDelete(testTaskUserID, 0)(mock)
+				expectTask(mock, 7, false)
+			},
+			wantStatus: http.StatusForbidden,
+			wantBody:   "You can only view this task",
+		},
+		{
+			name:       "invalid id",
+			method:     http.MethodDelete,
+			target:     "/task/seven",
+			wantStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestToggleDoneStatusTaskHandler(t *testing.T) {
+	expectToggle := func(mock sqlmock.Sqlmock) {
+		expectTask(mock, 7, false)
+		mock.ExpectPrepare(regexp.QuoteMeta("UPDATE task SET is_done")).ExpectExec().
+			WithArgs(true, 7, testTaskUserID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTask(mock, 7, true)
+	}
+
+	runTaskHandlerTests(t, []taskHandlerTest{
+		{
+			name:         "HTML",
+			method:       http.MethodPut,
+			target:       "/task/7",
+			expect:       expectToggle,
+			wantStatus:   http.StatusOK,
+			wantTemplate: "task",
+		},
+		{
+			name:       "JSON",
+			method:     http.MethodPut,
+			target:     "/task/7",
+			json:       true,
+			expect:     expectToggle,
+			wantStatus: http.StatusOK,
+			wantBody:   `"isDone":true`,
+		},
+		{
+			name:       "another user's task",
+			userID:     otherTaskUserID,
+			method:     http.MethodPut,
+			target:     "/task/7",
+			expect:     func(mock sqlmock.Sqlmock) { expectNoTask(mock, 7, otherTaskUserID) },
+			wantStatus: http.StatusNotFound,
+			wantBody:   "Task is not found",
+		},
+		{
+			name:       "invalid id",
+			method:     http.MethodPut,
+			target:     "/task/seven",
+			json:       true,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Task id must be a number",
+		},
+	})
+}
+
+func TestListTasksHandler(t *testing.T) {
+	expectTasks := func(mock sqlmock.Sqlmock) {
+		mock.ExpectPrepare(regexp.QuoteMeta("SELECT task.id")).ExpectQuery().
+			WithArgs(testTaskUserID).
+			WillReturnRows(taskRows(7, "Deploy", false))
+		expectTaskDetails(mock)
+	}
+
+	runTaskHandlerTests(t, []taskHandlerTest{
+		{
+			name:   "page",
+			method: http.MethodGet,
+			target: "/",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectTasks(mock)
+				expectLists(mock)
+			},
+			wantStatus:   http.StatusOK,
+			wantTemplate: "tasklist-page",
+		},
+		{
+			name:       "JSON",
+			method:     http.MethodGet,
+			target:     "/?order=due",
+			json:       true,
+			expect:     expectTasks,
+			wantStatus: http.StatusOK,
+			wantBody:   `"title":"Deploy"`,
+		},
+		{
+			name:       "unknown view",
+			method:     http.MethodGet,
+			target:     "/?view=someday",
+			wantStatus: http.StatusFound,
+		},
+		{
+			name:       "unknown view in JSON",
+			method:     http.MethodGet,
+			target:     "/?view=someday",
+			json:       true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "failing database",
+			method: http.MethodGet,
+			target: "/",
+			json:   true,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPrepare(regexp.QuoteMeta("SELECT task.id")).WillReturnError(errDatabaseDown)
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	})
+}
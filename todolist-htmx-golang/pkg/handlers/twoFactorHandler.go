@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/skip2/go-qrcode"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+type TwoFactorAuth interface {
+	BeginTOTPEnrollment(userID int) (string, error)
+	EnableTOTP(userID int, code string) ([]string, error)
+	DisableTOTP(userID int, code string) error
+	VerifySecondFactor(userID int, code string) error
+}
+
+type TwoFactorFormResponse struct {
+	Error      string
+	RetryAfter int
+}
+
+type TwoFactorSetupResponse struct {
+	Secret string
+	QRCode template.URL
+	Form   models.FormData
+}
+
+func LoginSecondFactorHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	twoFactorAuth TwoFactorAuth,
+	limiter LoginLimiter,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		userID, err := sessionStore.GetPendingSession(ctx.Request(), "pending_2fa")
+		if err != nil {
+			log.Info("POST /login/2fa without a pending session", "err", err)
+
+			response := TwoFactorFormResponse{Error: "Your login has expired, please log in again"}
+
+			return ctx.Render(http.StatusOK, "login-2fa-form", response)
+		}
+
+		user, err := userStorage.GetUserWithID(userID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		clientIP := ctx.RealIP()
+
+		lockout, err := limiter.Check(user.Login, clientIP)
+		if err != nil {
+			log.Error("failed to check a login lockout", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to login")
+		}
+
+		if lockout > 0 {
+			return lockedOutSecondFactorResponse(ctx, lockout)
+		}
+
+		err = twoFactorAuth.VerifySecondFactor(user.ID, ctx.FormValue("code"))
+		if errors.Is(err, models.ErrInvalidTOTPCode) {
+			log.Info("POST /login/2fa invalid code", "login", user.Login)
+
+			lockout, limiterErr := limiter.RegisterFailure(user.Login, clientIP)
+			if limiterErr != nil {
+				log.Error("failed to register a failed login", "err", limiterErr)
+			}
+
+			if lockout > 0 {
+				return lockedOutSecondFactorResponse(ctx, lockout)
+			}
+
+			response := TwoFactorFormResponse{Error: "Invalid code"}
+
+			return ctx.Render(http.StatusOK, "login-2fa-form", response)
+		}
+
+		if err != nil {
+			log.Error("failed to verify a second factor", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to login")
+		}
+
+		err = sessionStore.DeletePendingSession(&ctx.Response().Writer, ctx.Request(), "pending_2fa")
+		if err != nil {
+			log.Error("failed to delete a pending session", "err", err)
+		}
+
+		session := models.Session{
+			UserID:    user.ID,
+			IP:        clientIP,
+			UserAgent: ctx.Request().UserAgent(),
+		}
+
+		err = sessionStore.SetSession(&ctx.Response().Writer, "session", session)
+		if err != nil {
+			log.Error("failed to set a session", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to login")
+		}
+
+		err = limiter.Reset(user.Login)
+		if err != nil {
+			log.Error("failed to reset failed logins", "err", err)
+		}
+
+		log.Debug("POST /login/2fa logged successfully", "login", user.Login)
+
+		ctx.Response().Header().Set("HX-Redirect", "/")
+
+		return ctx.NoContent(http.StatusOK)
+	}
+}
+
+func lockedOutSecondFactorResponse(ctx echo.Context, lockout time.Duration) error {
+	retryAfter := int(math.Ceil(lockout.Seconds()))
+
+	ctx.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	response := TwoFactorFormResponse{
+		Error:      "Too many failed attempts",
+		RetryAfter: retryAfter,
+	}
+
+	return ctx.Render(http.StatusOK, "login-2fa-form", response)
+}
+
+func TwoFactorSetupHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	twoFactorAuth TwoFactorAuth,
+	issuer string,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(session.UserID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		secret, err := twoFactorAuth.BeginTOTPEnrollment(user.ID)
+		if errors.Is(err, models.ErrTOTPAlreadyEnabled) {
+			return ctx.Render(http.StatusOK, "two-factor-settings", user)
+		}
+
+		if err != nil {
+			log.Error("failed to begin totp enrollment", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to set up two-factor authentication")
+		}
+
+		qrCode, err := qrcode.Encode(models.TOTPURI(issuer, user.Login, secret), qrcode.Medium, 256)
+		if err != nil {
+			log.Error("failed to encode a qr code", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to set up two-factor authentication")
+		}
+
+		log.Info("POST /settings/2fa/setup", "userID", user.ID)
+
+		response := TwoFactorSetupResponse{
+			Secret: secret,
+			//nolint:gosec // the data URL is built from our own PNG bytes
+			QRCode: template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode)),
+			Form:   models.NewFormData(),
+		}
+
+		return ctx.Render(http.StatusOK, "two-factor-setup", response)
+	}
+}
+
+func EnableTwoFactorHandler(
+	sessionStore SessionStore,
+	twoFactorAuth TwoFactorAuth,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		codes, err := twoFactorAuth.EnableTOTP(session.UserID, ctx.FormValue("code"))
+		if errors.Is(err, models.ErrInvalidTOTPCode) || errors.Is(err, models.ErrTOTPNotEnrolled) {
+			formData := models.NewFormData()
+			formData.Errors["Code"] = err.Error()
+
+			ctx.Response().Header().Set("HX-Retarget", "#two-factor-enable-form")
+
+			return ctx.Render(http.StatusOK, "two-factor-enable-form", formData)
+		}
+
+		if err != nil {
+			log.Error("failed to enable totp", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		}
+
+		log.Info("POST /settings/2fa/enable", "userID", session.UserID)
+
+		return ctx.Render(http.StatusOK, "two-factor-recovery-codes", codes)
+	}
+}
+
+func DisableTwoFactorHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	twoFactorAuth TwoFactorAuth,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(session.UserID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		err = twoFactorAuth.DisableTOTP(user.ID, ctx.FormValue("code"))
+		if errors.Is(err, models.ErrInvalidTOTPCode) {
+			formData := models.NewFormData()
+			formData.Errors["Code"] = err.Error()
+
+			ctx.Response().Header().Set("HX-Retarget", "#two-factor-disable-form")
+
+			return ctx.Render(http.StatusOK, "two-factor-disable-form", formData)
+		}
+
+		if err != nil {
+			log.Error("failed to disable totp", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		}
+
+		log.Info("POST /settings/2fa/disable", "userID", user.ID)
+
+		user.TOTPEnabled = false
+
+		return ctx.Render(http.StatusOK, "two-factor-settings", user)
+	}
+}
@@ -1,37 +1,160 @@
 package handlers
 
 import (
+	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/mailer"
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
 )
 
 type UserAuth interface {
-	Register(login string, password string) error
-	Login(login string, password string) error
+	Register(login string, password string, email string) (models.User, error)
+	Login(login string, password string) (models.User, error)
 }
 
 type SessionStore interface {
-	GetSession(response *http.Request, key string) (string, error)
-	SetSession(response *http.ResponseWriter, key string, val string) error
+	GetSession(request *http.Request, key string) (models.Session, error)
+	SetSession(response *http.ResponseWriter, key string, session models.Session) error
+	DeleteSession(response *http.ResponseWriter, request *http.Request, key string) error
+	RevokeSession(userID int, sessionID string) error
+	RevokeAllSessions(userID int, exceptSessionID string) error
+	GetUserSessions(userID int) ([]models.Session, error)
+	SetPendingSession(response *http.ResponseWriter, key string, userID int) error
+	GetPendingSession(request *http.Request, key string) (int, error)
+	DeletePendingSession(response *http.ResponseWriter, request *http.Request, key string) error
+}
+
+const (
+	userIDContextKey   = "userID"
+	apiTokenContextKey = "apiToken"
+)
+
+type APITokenAuth interface {
+	AuthenticateAPIToken(token string) (models.APIToken, error)
 }
 
-func AuthorizationCheckMiddleware(store SessionStore, log *slog.Logger) echo.MiddlewareFunc {
+// AuthorizationCheckMiddleware lets in requests with a session cookie or with
+// an "Authorization: Bearer" API token. A token needs the read scope for safe
+// methods and the write scope for everything else.
+func AuthorizationCheckMiddleware(
+	store SessionStore,
+	tokenAuth APITokenAuth,
+	log *slog.Logger,
+) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(ctx echo.Context) error {
-			_, err := store.GetSession(ctx.Request(), "session")
+			if bearerToken, isBearer := bearerToken(ctx.Request()); isBearer {
+				return authorizeAPIToken(ctx, next, tokenAuth, bearerToken, log)
+			}
+
+			session, err := store.GetSession(ctx.Request(), "session")
 			if err != nil {
+				if isAPIRequest(ctx) || wantsJSON(ctx) {
+					log.Info("Not authorized!", "err", err)
+
+					return apiErrorResponse(ctx, http.StatusUnauthorized, "Log in or send an API token")
+				}
+
 				log.Info("Not authorized! Redirecting...", "err", err)
 
 				return ctx.Redirect(http.StatusFound, "/login")
 			}
 
+			ctx.Set(userIDContextKey, session.UserID)
+
+			return next(ctx)
+		}
+	}
+}
+
+func authorizeAPIToken(
+	ctx echo.Context,
+	next echo.HandlerFunc,
+	tokenAuth APITokenAuth,
+	bearerToken string,
+	log *slog.Logger,
+) error {
+	apiToken, err := tokenAuth.AuthenticateAPIToken(bearerToken)
+	if errors.Is(err, models.ErrInvalidAPIToken) {
+		log.Info("Invalid API token", "path", ctx.Request().URL.Path)
+
+		ctx.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+
+		return apiErrorResponse(ctx, http.StatusUnauthorized, err.Error())
+	}
+
+	if err != nil {
+		log.Error("failed to authenticate an API token", "err", err)
+
+		return apiErrorResponse(ctx, http.StatusInternalServerError, "Failed to authenticate")
+	}
+
+	scope := models.APITokenScopeWrite
+
+	switch ctx.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		scope = models.APITokenScopeRead
+	}
+
+	if !apiToken.HasScope(scope) {
+		log.Info("API token is missing a scope", "tokenID", apiToken.ID, "scope", scope)
+
+		ctx.Response().Header().Set(
+			"WWW-Authenticate",
+			`Bearer error="insufficient_scope", scope="`+scope+`"`,
+		)
+
+		return apiErrorResponse(ctx, http.StatusForbidden, "API token needs the "+scope+" scope")
+	}
+
+	ctx.Set(userIDContextKey, apiToken.UserID)
+	ctx.Set(apiTokenContextKey, apiToken)
+
+	return next(ctx)
+}
+
+// RequireSessionMiddleware keeps API tokens away from account settings, so a
+// leaked token can't be used to take over the account.
+func RequireSessionMiddleware(log *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if _, isAPIToken := ctx.Get(apiTokenContextKey).(models.APIToken); isAPIToken {
+				log.Info("API token used for a session only route", "path", ctx.Request().URL.Path)
+
+				return apiErrorResponse(ctx, http.StatusForbidden, "API tokens can't be used here")
+			}
+
 			return next(ctx)
 		}
 	}
 }
 
+// authenticatedUserID returns the user that AuthorizationCheckMiddleware let in.
+func authenticatedUserID(ctx echo.Context) (int, bool) {
+	userID, isSet := ctx.Get(userIDContextKey).(int)
+
+	return userID, isSet
+}
+
+func bearerToken(request *http.Request) (string, bool) {
+	const prefix = "bearer "
+
+	authorization := request.Header.Get("Authorization")
+	if len(authorization) < len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(authorization[len(prefix):]), true
+}
+
 func LoginPageHandler(log *slog.Logger) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
 		log.Info("GET /login")
@@ -40,69 +163,121 @@ func LoginPageHandler(log *slog.Logger) echo.HandlerFunc {
 	}
 }
 
+type LoginLimiter interface {
+	Check(login, ip string) (time.Duration, error)
+	RegisterFailure(login, ip string) (time.Duration, error)
+	Reset(login string) error
+}
+
 type LoginFormResponse struct {
-	LoginValue    string
-	PasswordValue string
-	Error         string
+	LoginValue string
+	Error      string
+	RetryAfter int
 }
 
 func LoginUserHandler(
 	sessionStorage SessionStore,
 	userAuth UserAuth,
+	limiter LoginLimiter,
 	log *slog.Logger,
 ) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
 		login := ctx.FormValue("login")
 		password := ctx.FormValue("password")
+		clientIP := ctx.RealIP()
 
-		err := userAuth.Login(login, password)
+		lockout, err := limiter.Check(login, clientIP)
 		if err != nil {
-			log.Debug(
-				"POST /login failed to login",
-				"login",
-				login,
-				"password",
-				password,
-				"err",
-				err,
-			)
+			log.Error("failed to check a login lockout", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to login")
+		}
+
+		if lockout > 0 {
+			log.Info("POST /login locked out", "login", login, "ip", clientIP)
+
+			return lockedOutResponse(ctx, login, lockout)
+		}
+
+		user, err := userAuth.Login(login, password)
+		if err != nil {
+			log.Debug("POST /login failed to login", "login", login, "err", err)
+
+			lockout, limiterErr := limiter.RegisterFailure(login, clientIP)
+			if limiterErr != nil {
+				log.Error("failed to register a failed login", "err", limiterErr)
+			}
+
+			if lockout > 0 {
+				log.Info("POST /login locked out", "login", login, "ip", clientIP)
+
+				return lockedOutResponse(ctx, login, lockout)
+			}
 
 			loginResponse := LoginFormResponse{
-				LoginValue:    login,
-				PasswordValue: password,
-				Error:         err.Error(),
+				LoginValue: login,
+				Error:      err.Error(),
 			}
 
 			return ctx.Render(http.StatusOK, "login-page", loginResponse)
 		}
 
-		err = sessionStorage.SetSession(&ctx.Response().Writer, "session", login)
+		if user.TOTPEnabled {
+			err = sessionStorage.SetPendingSession(&ctx.Response().Writer, "pending_2fa", user.ID)
+			if err != nil {
+				log.Error("failed to set a pending session", "err", err)
+
+				return ctx.String(http.StatusInternalServerError, "Failed to login")
+			}
+
+			log.Debug("POST /login waiting for a second factor", "login", login)
+
+			return ctx.Render(http.StatusOK, "login-2fa-page", TwoFactorFormResponse{})
+		}
+
+		err = limiter.Reset(login)
 		if err != nil {
-			log.Debug(
-				"POST /login failed to login",
-				"login",
-				login,
-				"password",
-				password,
-				"err",
-				err,
-			)
+			log.Error("failed to reset failed logins", "err", err)
+		}
+
+		session := models.Session{
+			UserID:    user.ID,
+			IP:        ctx.RealIP(),
+			UserAgent: ctx.Request().UserAgent(),
+		}
+
+		err = sessionStorage.SetSession(&ctx.Response().Writer, "session", session)
+		if err != nil {
+			log.Debug("POST /login failed to login", "login", login, "err", err)
 
 			loginResponse := LoginFormResponse{
-				LoginValue:    login,
-				PasswordValue: password,
-				Error:         err.Error(),
+				LoginValue: login,
+				Error:      err.Error(),
 			}
 
 			return ctx.Render(http.StatusOK, "login-page", loginResponse)
 		}
 
-		log.Debug("POST /login logged successfully", "login", login, "password", password)
+		log.Debug("POST /login logged successfully", "login", login)
 
 		return ctx.Redirect(http.StatusFound, "/")
 	}
 }
 
+func lockedOutResponse(ctx echo.Context, login string, lockout time.Duration) error {
+	retryAfter := int(math.Ceil(lockout.Seconds()))
+
+	ctx.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	loginResponse := LoginFormResponse{
+		LoginValue: login,
+		Error:      "Too many failed attempts",
+		RetryAfter: retryAfter,
+	}
+
+	return ctx.Render(http.StatusTooManyRequests, "login-page", loginResponse)
+}
+
 func RegisterPageHandler(log *slog.Logger) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
 		log.Info("GET /register")
@@ -112,29 +287,142 @@ func RegisterPageHandler(log *slog.Logger) echo.HandlerFunc {
 }
 
 type RegisterFormResponse struct {
-	LoginValue    string
-	PasswordValue string
-	Error         string
+	LoginValue string
+	EmailValue string
+	Error      string
 }
 
-func RegisterUserHandler(userAuth UserAuth, log *slog.Logger) echo.HandlerFunc {
+func RegisterUserHandler(
+	userAuth UserAuth,
+	verifier EmailVerifier,
+	mail mailer.Mailer,
+	baseURL string,
+	log *slog.Logger,
+) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
 		login := ctx.FormValue("login")
 		password := ctx.FormValue("password")
+		email := ctx.FormValue("email")
 
-		log.Info("POST /register", "login", login, "password", password)
+		log.Info("POST /register", "login", login)
 
-		err := userAuth.Register(login, password)
+		user, err := userAuth.Register(login, password, email)
 		if err != nil {
 			registerResponse := RegisterFormResponse{
 				login,
-				password,
+				email,
 				err.Error(),
 			}
 
 			return ctx.Render(http.StatusOK, "register-form", registerResponse)
 		}
 
+		err = sendVerificationMail(verifier, mail, baseURL, user)
+		if err != nil {
+			log.Error("failed to send a verification mail", "err", err)
+		}
+
 		return ctx.Redirect(http.StatusFound, "/login")
 	}
 }
+
+func LogoutHandler(sessionStore SessionStore, log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		err := sessionStore.DeleteSession(&ctx.Response().Writer, ctx.Request(), "session")
+		if err != nil {
+			log.Error("failed to delete a session", "err", err)
+		}
+
+		log.Info("POST /logout")
+
+		return ctx.Redirect(http.StatusFound, "/login")
+	}
+}
+
+func LogoutEverywhereHandler(sessionStore SessionStore, log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		err = sessionStore.RevokeAllSessions(session.UserID, "")
+		if err != nil {
+			log.Error("failed to revoke sessions", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to sign out everywhere")
+		}
+
+		err = sessionStore.DeleteSession(&ctx.Response().Writer, ctx.Request(), "session")
+		if err != nil && !errors.Is(err, models.ErrSessionNotFound) {
+			log.Error("failed to delete a session", "err", err)
+		}
+
+		log.Info("POST /logout/all", "userID", session.UserID)
+
+		return ctx.Redirect(http.StatusFound, "/login")
+	}
+}
+
+func SessionsPageHandler(
+	sessionStore SessionStore,
+	userStorage UserStorage,
+	log *slog.Logger,
+) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		user, err := userStorage.GetUserWithID(session.UserID)
+		if err != nil {
+			log.Error("failed to get user by id", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user by id")
+		}
+
+		sessions, err := sessionStore.GetUserSessions(session.UserID)
+		if err != nil {
+			log.Error("failed to get user sessions", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "failed to get user sessions")
+		}
+
+		page := models.NewSessionsPage(user, sessions, session.ID)
+
+		return ctx.Render(http.StatusOK, "sessions-page", page)
+	}
+}
+
+func RevokeSessionHandler(sessionStore SessionStore, log *slog.Logger) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		session, err := sessionStore.GetSession(ctx.Request(), "session")
+		if err != nil {
+			log.Info("Not authorized! Redirecting...", "err", err)
+
+			return ctx.Redirect(http.StatusFound, "/login")
+		}
+
+		sessionID := ctx.Param("id")
+
+		log.Info("DELETE /sessions/:id", "userID", session.UserID)
+
+		err = sessionStore.RevokeSession(session.UserID, sessionID)
+		if errors.Is(err, models.ErrSessionNotFound) {
+			return ctx.String(http.StatusNotFound, "Session is not found")
+		}
+
+		if err != nil {
+			log.Error("failed to revoke a session", "err", err)
+
+			return ctx.String(http.StatusInternalServerError, "Failed to revoke a session")
+		}
+
+		return ctx.NoContent(http.StatusOK)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+// apiTokens authenticates the tokens it holds.
+type apiTokens map[string]models.APIToken
+
+func (tokens apiTokens) AuthenticateAPIToken(token string) (models.APIToken, error) {
+	apiToken, found := tokens[token]
+	if !found {
+		return models.APIToken{}, models.ErrInvalidAPIToken
+	}
+
+	return apiToken, nil
+}
+
+func TestAuthenticationFailuresAreProblemDocuments(t *testing.T) {
+	tokens := apiTokens{
+		"read-token": {ID: 1, UserID: 1, Scopes: []string{models.APITokenScopeRead}},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{
+			name:       "API without a session",
+			method:     http.MethodGet,
+			target:     "/api/v1/tasks",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "task route asking for JSON without a session",
+			method:     http.MethodGet,
+			target:     "/",
+			headers:    map[string]string{echo.HeaderAccept: echo.MIMEApplicationJSON},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid API token",
+			method:     http.MethodGet,
+			target:     "/",
+			headers:    map[string]string{echo.HeaderAuthorization: "Bearer forged"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "API token without the write scope",
+			method:     http.MethodPost,
+			target:     "/tasks",
+			headers:    map[string]string{echo.HeaderAuthorization: "Bearer read-token"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "API token on a session only route",
+			method:     http.MethodGet,
+			target:     "/settings",
+			headers:    map[string]string{echo.HeaderAuthorization: "Bearer read-token"},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	server := echo.New()
+	log := discardLogger()
+	ok := func(ctx echo.Context) error { return ctx.NoContent(http.StatusOK) }
+
+	authenticated := server.Group("", AuthorizationCheckMiddleware(newMemorySessions(), tokens, log))
+	authenticated.GET("/", ok)
+	authenticated.POST("/tasks", ok)
+	authenticated.GET("/api/v1/tasks", ok)
+	authenticated.Group("", RequireSessionMiddleware(log)).GET("/settings", ok)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.target, nil)
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, test.wantStatus)
+			}
+
+			if contentType := recorder.Header().Get(echo.HeaderContentType); contentType != MIMEApplicationProblemJSON {
+				t.Errorf("Content-Type = %q, want %q", contentType, MIMEApplicationProblemJSON)
+			}
+
+			problem := ProblemDetails{}
+
+			err := json.Unmarshal(recorder.Body.Bytes(), &problem)
+			if err != nil {
+				t.Fatalf("body is not a problem document: %v: %s", err, recorder.Body.String())
+			}
+
+			if problem.Status != test.wantStatus || problem.Title == "" || problem.Detail == "" {
+				t.Errorf("problem = %+v", problem)
+			}
+		})
+	}
+}
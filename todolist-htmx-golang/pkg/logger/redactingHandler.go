@@ -0,0 +1,160 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+func DefaultSensitiveKeys() []string {
+	return []string{"password", "token", "cookie", "authorization", "secret"}
+}
+
+// RedactingHandler wraps another slog.Handler and replaces the values of
+// attributes whose key contains one of the sensitive keys, including
+// attributes nested in groups and maps.
+type RedactingHandler struct {
+	next slog.Handler
+	keys []string
+}
+
+func NewRedactingHandler(next slog.Handler, keys []string) *RedactingHandler {
+	lowerKeys := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key != "" {
+			lowerKeys = append(lowerKeys, key)
+		}
+	}
+
+	return &RedactingHandler{next: next, keys: lowerKeys}
+}
+
+func (handler *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return handler.next.Enabled(ctx, level)
+}
+
+func (handler *RedactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(handler.redactAttr(attr))
+
+		return true
+	})
+
+	return handler.next.Handle(ctx, redacted)
+}
+
+func (handler *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+
+	for _, attr := range attrs {
+		redacted = append(redacted, handler.redactAttr(attr))
+	}
+
+	return &RedactingHandler{next: handler.next.WithAttrs(redacted), keys: handler.keys}
+}
+
+func (handler *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: handler.next.WithGroup(name), keys: handler.keys}
+}
+
+func (handler *RedactingHandler) redactAttr(attr slog.Attr) slog.Attr {
+	if handler.isSensitive(attr.Key) {
+		return slog.String(attr.Key, redactedValue)
+	}
+
+	value := attr.Value.Resolve()
+
+	switch value.Kind() {
+	case slog.KindGroup:
+		groupAttrs := value.Group()
+		redacted := make([]any, 0, len(groupAttrs))
+
+		for _, groupAttr := range groupAttrs {
+			redacted = append(redacted, handler.redactAttr(groupAttr))
+		}
+
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		return slog.Any(attr.Key, handler.redactAny(value.Any()))
+	default:
+		return slog.Attr{Key: attr.Key, Value: value}
+	}
+}
+
+func (handler *RedactingHandler) redactAny(value any) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		redacted := make(map[string]any, len(typed))
+
+		for key, nested := range typed {
+			if handler.isSensitive(key) {
+				redacted[key] = redactedValue
+			} else {
+				redacted[key] = handler.redactAny(nested)
+			}
+		}
+
+		return redacted
+	case map[string]string:
+		redacted := make(map[string]string, len(typed))
+
+		for key, nested := range typed {
+			if handler.isSensitive(key) {
+				redacted[key] = redactedValue
+			} else {
+				redacted[key] = nested
+			}
+		}
+
+		return redacted
+	case http.Header:
+		return http.Header(handler.redactStrings(typed))
+	case map[string][]string:
+		return handler.redactStrings(typed)
+	case []any:
+		redacted := make([]any, 0, len(typed))
+
+		for _, nested := range typed {
+			redacted = append(redacted, handler.redactAny(nested))
+		}
+
+		return redacted
+	case slog.Attr:
+		return handler.redactAttr(typed)
+	default:
+		return value
+	}
+}
+
+func (handler *RedactingHandler) redactStrings(values map[string][]string) map[string][]string {
+	redacted := make(map[string][]string, len(values))
+
+	for key, nested := range values {
+		if handler.isSensitive(key) {
+			redacted[key] = []string{redactedValue}
+		} else {
+			redacted[key] = nested
+		}
+	}
+
+	return redacted
+}
+
+func (handler *RedactingHandler) isSensitive(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, sensitiveKey := range handler.keys {
+		if strings.Contains(key, sensitiveKey) {
+			return true
+		}
+	}
+
+	return false
+}
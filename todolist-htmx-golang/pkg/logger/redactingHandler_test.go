@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newTestLogger(buffer *bytes.Buffer) *slog.Logger {
+	textHandler := slog.NewTextHandler(buffer, &slog.HandlerOptions{Level: slog.LevelDebug})
+
+	return slog.New(NewRedactingHandler(textHandler, DefaultSensitiveKeys()))
+}
+
+func TestRedactingHandlerKeepsSecretsOutOfTheLog(t *testing.T) {
+	const secret = "hunter2-s3cr3t"
+
+	tests := []struct {
+		name string
+		log  func(log *slog.Logger)
+	}{
+		{"password attribute", func(log *slog.Logger) {
+			log.Info("POST /login", "login", "bob", "password", secret)
+		}},
+		{"key containing a sensitive word", func(log *slog.Logger) {
+			log.Info("reset", "resetToken", secret)
+		}},
+		{"upper case key", func(log *slog.Logger) {
+			log.Info("request", "Authorization", "Bearer "+secret)
+		}},
+		{"nested group", func(log *slog.Logger) {
+			log.Info("register", slog.Group("form", slog.Group("account", slog.String("password", secret))))
+		}},
+		{"map value", func(log *slog.Logger) {
+			log.Info("form", "values", map[string]any{"user": map[string]any{"client_secret": secret}})
+		}},
+		{"string map", func(log *slog.Logger) {
+			log.Info("cookies", "values", map[string]string{"session_cookie": secret})
+		}},
+		{"http header", func(log *slog.Logger) {
+			log.Info("headers", "header", http.Header{"Cookie": {"session=" + secret}})
+		}},
+		{"slice of attributes", func(log *slog.Logger) {
+			log.Info("attrs", "list", []any{slog.String("apiToken", secret)})
+		}},
+		{"logger with attributes", func(log *slog.Logger) {
+			log.With("password", secret).Info("with")
+		}},
+		{"logger with a group", func(log *slog.Logger) {
+			log.WithGroup("smtp").Info("config", "password", secret)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+
+			test.log(newTestLogger(&buffer))
+
+			output := buffer.String()
+
+			if strings.Contains(output, secret) {
+				t.Errorf("secret reached the log: %s", output)
+			}
+
+			if !strings.Contains(output, redactedValue) {
+				t.Errorf("log has no %s marker: %s", redactedValue, output)
+			}
+		})
+	}
+}
+
+func TestRedactingHandlerKeepsOtherAttributes(t *testing.T) {
+	var buffer bytes.Buffer
+
+	newTestLogger(&buffer).Info("POST /login", "login", "bob", "ip", "10.0.0.1")
+
+	output := buffer.String()
+
+	for _, want := range []string{"login=bob", "ip=10.0.0.1"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("log is missing %q: %s", want, output)
+		}
+	}
+}
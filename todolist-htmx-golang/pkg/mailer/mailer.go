@@ -0,0 +1,144 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(message Message) error
+}
+
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(host, port),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (mailer *SMTPMailer) Send(message Message) error {
+	const funcErrMsg = "mailer.SMTPMailer.Send"
+
+	var auth smtp.Auth
+	if mailer.username != "" {
+		auth = smtp.PlainAuth("", mailer.username, mailer.password, mailer.host)
+	}
+
+	err := smtp.SendMail(
+		mailer.addr,
+		auth,
+		mailer.from,
+		[]string{message.To},
+		formatMessage(mailer.from, message),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: failed to send a mail: %w", funcErrMsg, err)
+	}
+
+	return nil
+}
+
+// FileMailer writes every message as an .eml file into a directory, so links
+// can be opened by hand during development and read back in tests.
+type FileMailer struct {
+	dir  string
+	from string
+	log  *slog.Logger
+}
+
+func NewFileMailer(dir, from string, log *slog.Logger) (*FileMailer, error) {
+	const funcErrMsg = "mailer.NewFileMailer"
+
+	const dirPerm = 0o750
+
+	err := os.MkdirAll(dir, dirPerm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to create a directory: %w", funcErrMsg, err)
+	}
+
+	return &FileMailer{dir: dir, from: from, log: log}, nil
+}
+
+func (mailer *FileMailer) Send(message Message) error {
+	const funcErrMsg = "mailer.FileMailer.Send"
+
+	const filePerm = 0o600
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFileName(message.To))
+	path := filepath.Join(mailer.dir, name)
+
+	err := os.WriteFile(path, formatMessage(mailer.from, message), filePerm)
+	if err != nil {
+		return fmt.Errorf("%s: failed to write a mail: %w", funcErrMsg, err)
+	}
+
+	mailer.log.Info("mail written to a file", "to", message.To, "path", path)
+
+	return nil
+}
+
+// LogMailer only logs the recipient and the subject of messages, since their
+// bodies carry reset and verification links. It is the default when no mailer
+// is configured.
+type LogMailer struct {
+	log *slog.Logger
+}
+
+func NewLogMailer(log *slog.Logger) *LogMailer {
+	return &LogMailer{log: log}
+}
+
+func (mailer *LogMailer) Send(message Message) error {
+	mailer.log.Info("mail", "to", message.To, "subject", message.Subject)
+
+	return nil
+}
+
+func formatMessage(from string, message Message) []byte {
+	stripNewlines := strings.NewReplacer("\r", "", "\n", "")
+
+	headers := []string{
+		"From: " + stripNewlines.Replace(from),
+		"To: " + stripNewlines.Replace(message.To),
+		"Subject: " + stripNewlines.Replace(message.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + message.Body)
+}
+
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+
+		return '_'
+	}, name)
+}
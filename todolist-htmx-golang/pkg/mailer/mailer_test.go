@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/logger"
+)
+
+func TestLogMailerKeepsTheBodyOutOfTheLog(t *testing.T) {
+	const link = "http://localhost:8080/reset-password?token=s3cr3t-reset-token"
+
+	var buffer bytes.Buffer
+
+	textHandler := slog.NewTextHandler(&buffer, nil)
+	log := slog.New(logger.NewRedactingHandler(textHandler, logger.DefaultSensitiveKeys()))
+
+	err := NewLogMailer(log).Send(Message{
+		To:      "bob@example.com",
+		Subject: "Reset your password",
+		Body:    "Open " + link + " to choose a new password.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := buffer.String()
+
+	for _, secret := range []string{link, "s3cr3t-reset-token", "choose a new password"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("mail body reached the log: %s", output)
+		}
+	}
+
+	for _, want := range []string{"bob@example.com", "Reset your password"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("log is missing %q: %s", want, output)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	APITokenScopeRead  = "read"
+	APITokenScopeWrite = "write"
+
+	// apiTokenPrefix makes tokens easy to recognise, e.g. by secret scanners.
+	apiTokenPrefix = "tdl_"
+)
+
+var (
+	ErrInvalidAPIToken   = errors.New("API token is invalid or has expired")
+	ErrAPITokenNotFound  = errors.New("API token is not found")
+	ErrEmptyAPITokenName = errors.New("token name can't be empty")
+	ErrInvalidScopes     = errors.New("choose at least one of the read and write scopes")
+)
+
+type APIToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+func (token APIToken) HasScope(scope string) bool {
+	return slices.Contains(token.Scopes, scope)
+}
+
+// CreateAPIToken returns a new personal access token. Only its hash is stored,
+// so it can't be shown again. A nil expiresAt means the token never expires.
+func (storage *UserStorage) CreateAPIToken(
+	userID int,
+	name string,
+	scopes []string,
+	expiresAt *time.Time,
+) (string, error) {
+	const funcErrMsg = "storage.UserStorage.CreateAPIToken"
+
+	if name == "" {
+		return "", ErrEmptyAPITokenName
+	}
+
+	if len(scopes) == 0 {
+		return "", ErrInvalidScopes
+	}
+
+	for _, scope := range scopes {
+		if scope != APITokenScopeRead && scope != APITokenScopeWrite {
+			return "", ErrInvalidScopes
+		}
+	}
+
+	token, err := NewToken()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	token = apiTokenPrefix + token
+
+	const query = `
+		INSERT INTO api_token(user_id, name, token_hash, scopes, expires_at)
+			VALUES ($1, $2, $3, $4, $5);
+		`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return "", fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userID, name, HashToken(token), pq.Array(scopes), expiresAt)
+	if err != nil {
+		return "", fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("created an API token", "id", userID, "scopes", scopes)
+
+	return token, nil
+}
+
+func (storage *UserStorage) GetAPITokens(userID int) ([]APIToken, error) {
+	const funcErrMsg = "storage.UserStorage.GetAPITokens"
+
+	const query = `
+		SELECT id, user_id, name, scopes, created_at, expires_at, last_used_at FROM api_token
+			WHERE user_id = $1 ORDER BY created_at DESC;
+		`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.Query(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to query a statement: %w", funcErrMsg, err)
+	}
+
+	defer rows.Close()
+
+	tokens := []APIToken{}
+
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", funcErrMsg, err)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s failed to check rows.Err(): %w", funcErrMsg, err)
+	}
+
+	return tokens, nil
+}
+
+func (storage *UserStorage) RevokeAPIToken(userID, tokenID int) error {
+	const funcErrMsg = "storage.UserStorage.RevokeAPIToken"
+
+	const query = `DELETE FROM api_token WHERE id = $1 AND user_id = $2`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	result, err := stmt.Exec(tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrAPITokenNotFound
+	}
+
+	storage.log.Info("revoked an API token", "id", userID, "tokenID", tokenID)
+
+	return nil
+}
+
+// AuthenticateAPIToken returns the token if it exists and hasn't expired, and
+// records that it was used.
+func (storage *UserStorage) AuthenticateAPIToken(token string) (APIToken, error) {
+	const funcErrMsg = "storage.UserStorage.AuthenticateAPIToken"
+
+	const query = `
+		UPDATE api_token SET last_used_at = now()
+			WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > now())
+			RETURNING id, user_id, name, scopes, created_at, expires_at, last_used_at;
+		`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return APIToken{}, fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	apiToken, err := scanAPIToken(stmt.QueryRow(HashToken(token)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIToken{}, ErrInvalidAPIToken
+	}
+
+	if err != nil {
+		return APIToken{}, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	return apiToken, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIToken(row rowScanner) (APIToken, error) {
+	var (
+		token      APIToken
+		expiresAt  sql.NullTime
+		lastUsedAt sql.NullTime
+	)
+
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		pq.Array(&token.Scopes),
+		&token.CreatedAt,
+		&expiresAt,
+		&lastUsedAt,
+	)
+	if err != nil {
+		return APIToken{}, fmt.Errorf("failed to scan an API token: %w", err)
+	}
+
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return token, nil
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+var ErrInvalidVerificationToken = errors.New("verification link is invalid or has expired")
+
+const emailVerificationTokenTTL = 24 * time.Hour
+
+// ChangeEmail sets a new address for the user. The address has to be verified
+// again before features that send mail to it are available.
+func (storage *UserStorage) ChangeEmail(userID int, email string) (string, error) {
+	const funcErrMsg = "storage.UserStorage.ChangeEmail"
+
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	const query = `
+		UPDATE "user" SET email = $1, email_verified = FALSE
+			WHERE id = $2 AND email IS DISTINCT FROM $1;
+		`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return "", fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(email, userID)
+	if isUniqueViolation(err) {
+		return "", ErrEmailAlreadyUsed
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("changed an email", "id", userID)
+
+	return email, nil
+}
+
+// CreateEmailVerificationToken returns a single-use token that proves the user
+// can read mail sent to the address.
+func (storage *UserStorage) CreateEmailVerificationToken(userID int, email string) (string, error) {
+	const funcErrMsg = "storage.UserStorage.CreateEmailVerificationToken"
+
+	token, err := NewToken()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	const query = `
+		INSERT INTO email_verification_token(user_id, email, token_hash, expires_at)
+			VALUES ($1, $2, $3, $4);
+		`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return "", fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userID, email, HashToken(token), time.Now().Add(emailVerificationTokenTTL))
+	if err != nil {
+		return "", fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	return token, nil
+}
+
+// VerifyEmail spends the token and marks the address as verified, unless the
+// user changed the address after the link was sent.
+func (storage *UserStorage) VerifyEmail(token string) error {
+	const funcErrMsg = "storage.UserStorage.VerifyEmail"
+
+	tx, err := storage.database.Begin()
+	if err != nil {
+		return fmt.Errorf("%s failed to begin a transaction: %w", funcErrMsg, err)
+	}
+
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	var (
+		userID int
+		email  string
+	)
+
+	err = tx.QueryRow(`
+		UPDATE email_verification_token SET used_at = now()
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+			RETURNING user_id, email;
+		`, HashToken(token)).Scan(&userID, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidVerificationToken
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s failed to use a token: %w", funcErrMsg, err)
+	}
+
+	result, err := tx.Exec(
+		`UPDATE "user" SET email_verified = TRUE WHERE id = $1 AND email = $2`,
+		userID,
+		email,
+	)
+	if err != nil {
+		return fmt.Errorf("%s failed to verify an email: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidVerificationToken
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("%s failed to commit a transaction: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("verified an email", "id", userID)
+
+	return nil
+}
+
+func (storage *UserStorage) emailIsTaken(email string) (bool, error) {
+	const funcErrMsg = "storage.UserStorage.emailIsTaken"
+
+	const query = `SELECT EXISTS(SELECT 1 FROM "user" WHERE lower(email) = lower($1))`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return false, fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	var isTaken bool
+
+	err = stmt.QueryRow(email).Scan(&isTaken)
+	if err != nil {
+		return false, fmt.Errorf("%s failed to scan a row: %w", funcErrMsg, err)
+	}
+
+	return isTaken, nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Name != "" {
+		return "", ErrInvalidEmail
+	}
+
+	return address.Address, nil
+}
@@ -1,5 +1,43 @@
 package models
 
-import "errors"
+import (
+	"errors"
 
-var ErrTaskAlreadyExist = errors.New("Task already exist")
+	"github.com/lib/pq"
+)
+
+var (
+	ErrTaskAlreadyExist       = errors.New("Task already exist")
+	ErrTaskNotFound           = errors.New("task is not found")
+	ErrEmptyTaskTitle         = errors.New("task title can't be empty")
+	ErrTaskTitleTooLong       = errors.New("task title can't be longer than 200 characters")
+	ErrTaskDescriptionTooLong = errors.New("task description can't be longer than 10000 characters")
+	ErrInvalidDueDate         = errors.New("due date must be a date and a time")
+	ErrUnknownTaskView        = errors.New("unknown task view")
+	ErrInvalidPriority        = errors.New("priority must be none, low, medium, high or urgent")
+	ErrUnknownTaskOrder       = errors.New("unknown task order")
+	ErrTagNotFound            = errors.New("tag is not found")
+	ErrTagAlreadyExist        = errors.New("tag already exists")
+	ErrInvalidTagName         = errors.New("tag name must start with a letter and have up to 32 letters, digits, - or _")
+	ErrInvalidTagColor        = errors.New("unknown tag color")
+	ErrListNotFound           = errors.New("list is not found")
+	ErrListAlreadyExist       = errors.New("list already exists")
+	ErrEmptyListName          = errors.New("list name can't be empty")
+	ErrListNameTooLong        = errors.New("list name can't be longer than 100 characters")
+	ErrListArchived           = errors.New("list is archived")
+	ErrPermissionDenied       = errors.New("you don't have permission to do that")
+	ErrInvalidListRole        = errors.New("role must be viewer or editor")
+	ErrCannotShareWithOwner   = errors.New("a list can't be shared with its owner")
+	ErrListMemberNotFound     = errors.New("list member is not found")
+	ErrSubtaskNotFound        = errors.New("checklist item is not found")
+	ErrEmptySubtaskTitle      = errors.New("checklist item can't be empty")
+	ErrSubtaskTitleTooLong    = errors.New("checklist item can't be longer than 200 characters")
+)
+
+const pqUniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation
+}
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrIdentityAlreadyLinked = errors.New("this account is already linked to a user")
+
+const maxLoginSuffix = 100
+
+// ExternalIdentity is a user as an OpenID Connect provider knows them. Provider
+// and Subject identify them; the rest is only used to fill in a new account.
+type ExternalIdentity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+}
+
+type LinkedIdentity struct {
+	Provider  string
+	Email     string
+	CreatedAt time.Time
+}
+
+// LoginWithIdentity returns the user linked to the identity and creates one on
+// the first login. Existing accounts are never matched by email: they have to
+// link the identity from the settings page.
+func (storage *UserStorage) LoginWithIdentity(identity ExternalIdentity) (User, error) {
+	const funcErrMsg = "storage.UserStorage.LoginWithIdentity"
+
+	userID, err := storage.getIdentityUserID(identity)
+	if errors.Is(err, ErrUserNotFound) {
+		userID, err = storage.addIdentityUser(identity)
+	}
+
+	if err != nil {
+		return User{}, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	user, err := storage.GetUserWithID(userID)
+	if err != nil {
+		return User{}, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	return user, nil
+}
+
+func (storage *UserStorage) LinkIdentity(userID int, identity ExternalIdentity) error {
+	const funcErrMsg = "storage.UserStorage.LinkIdentity"
+
+	const query = `
+		INSERT INTO user_identity(user_id, provider, subject, email)
+			VALUES ($1, $2, $3, NULLIF($4, ''));
+		`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userID, identity.Provider, identity.Subject, identity.Email)
+	if isUniqueViolation(err) {
+		return ErrIdentityAlreadyLinked
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("linked an identity", "id", userID, "provider", identity.Provider)
+
+	return nil
+}
+
+func (storage *UserStorage) GetUserIdentities(userID int) ([]LinkedIdentity, error) {
+	const funcErrMsg = "storage.UserStorage.GetUserIdentities"
+
+	const query = `
+		SELECT provider, COALESCE(email, ''), created_at FROM user_identity
+			WHERE user_id = $1 ORDER BY created_at;
+		`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.Query(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to query a statement: %w", funcErrMsg, err)
+	}
+
+	defer rows.Close()
+
+	identities := []LinkedIdentity{}
+
+	for rows.Next() {
+		identity := LinkedIdentity{}
+
+		err = rows.Scan(&identity.Provider, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to scan an identity: %w", funcErrMsg, err)
+		}
+
+		identities = append(identities, identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s failed to check rows.Err(): %w", funcErrMsg, err)
+	}
+
+	return identities, nil
+}
+
+func (storage *UserStorage) getIdentityUserID(identity ExternalIdentity) (int, error) {
+	const funcErrMsg = "storage.UserStorage.getIdentityUserID"
+
+	const query = `SELECT user_id FROM user_identity WHERE provider = $1 AND subject = $2`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	var userID int
+
+	err = stmt.QueryRow(identity.Provider, identity.Subject).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUserNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to scan a row: %w", funcErrMsg, err)
+	}
+
+	return userID, nil
+}
+
+// addIdentityUser creates a user for a new identity. The user gets a random
+// password nobody knows, so they can only log in through the provider until
+// they reset it.
+func (storage *UserStorage) addIdentityUser(identity ExternalIdentity) (int, error) {
+	const funcErrMsg = "storage.UserStorage.addIdentityUser"
+
+	login, err := storage.availableLogin(identity)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	password, err := NewToken()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	passwordHash, err := storage.hasher.Hash(password)
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to hash a password: %w", funcErrMsg, err)
+	}
+
+	email := ""
+
+	if identity.EmailVerified {
+		normalized, err := normalizeEmail(identity.Email)
+		if err == nil {
+			isTaken, err := storage.emailIsTaken(normalized)
+			if err != nil {
+				return 0, fmt.Errorf("%s failed to check is email is taken: %w", funcErrMsg, err)
+			}
+
+			if !isTaken {
+				email = normalized
+			}
+		}
+	}
+
+	tx, err := storage.database.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to begin a transaction: %w", funcErrMsg, err)
+	}
+
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	var userID int
+
+	err = tx.QueryRow(
+		`INSERT INTO "user"(login, password, email, email_verified)
+			VALUES ($1, $2, NULLIF($3, ''), $3 <> '') RETURNING id`,
+		login,
+		passwordHash,
+		email,
+	).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to insert a user: %w", funcErrMsg, err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO user_identity(user_id, provider, subject, email) VALUES ($1, $2, $3, NULLIF($4, ''))`,
+		userID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to insert an identity: %w", funcErrMsg, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to commit a transaction: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("created a user for an identity", "id", userID, "provider", identity.Provider)
+
+	return userID, nil
+}
+
+// availableLogin picks a login from the identity's username or email and adds
+// a number to it if it is taken.
+func (storage *UserStorage) availableLogin(identity ExternalIdentity) (string, error) {
+	const funcErrMsg = "storage.UserStorage.availableLogin"
+
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	if base == "" {
+		base = identity.Provider + "-user"
+	}
+
+	for suffix := 0; suffix < maxLoginSuffix; suffix++ {
+		login := base
+		if suffix != 0 {
+			login = base + "-" + strconv.Itoa(suffix)
+		}
+
+		isTaken, err := storage.loginIsTaken(login)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", funcErrMsg, err)
+		}
+
+		if !isTaken {
+			return login, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: %w", funcErrMsg, ErrUserAlreadyExist)
+}
@@ -0,0 +1,275 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxListNameLength = 100
+
+// List is a named task list of a user. Tasks that are in no list are in the
+// Inbox, which isn't stored. Role is what the user reading the list can do
+// with it.
+type List struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	IsArchived bool      `json:"isArchived"`
+	CreatedAt  time.Time `json:"createdAt"`
+	OwnerID    int       `json:"ownerId"`
+	Owner      string    `json:"owner"`
+	Role       ListRole  `json:"role"`
+}
+
+// ListUpdate holds the fields to change in a list; nil fields are kept.
+type ListUpdate struct {
+	Name       *string
+	IsArchived *bool
+}
+
+const listColumns = `task_list.id, task_list.name, task_list.is_archived, task_list.created_at`
+
+// listQuery selects the lists that the user whose id is $1 owns or is a
+// member of, with the role they have in each.
+const listQuery = `
+	SELECT ` + listColumns + `, task_list.user_id, owner.login,
+		CASE WHEN task_list.user_id = $1 THEN 'owner' ELSE task_list_member.role END
+		FROM task_list
+		JOIN "user" AS owner ON owner.id = task_list.user_id
+		LEFT JOIN task_list_member
+			ON task_list_member.list_id = task_list.id AND task_list_member.user_id = $1
+		WHERE (task_list.user_id = $1 OR task_list_member.user_id IS NOT NULL)`
+
+func scanList(row rowScanner) (List, error) {
+	list := List{}
+
+	err := row.Scan(
+		&list.ID,
+		&list.Name,
+		&list.IsArchived,
+		&list.CreatedAt,
+		&list.OwnerID,
+		&list.Owner,
+		&list.Role,
+	)
+
+	return list, err
+}
+
+// scanOwnList reads a row of listColumns of a list the user owns.
+func (user *User) scanOwnList(row rowScanner) (List, error) {
+	list := List{OwnerID: user.ID, Owner: user.Login, Role: ListRoleOwner}
+
+	err := row.Scan(&list.ID, &list.Name, &list.IsArchived, &list.CreatedAt)
+
+	return list, err
+}
+
+func validateListName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return "", ErrEmptyListName
+	}
+
+	if utf8.RuneCountInString(name) > maxListNameLength {
+		return "", ErrListNameTooLong
+	}
+
+	return name, nil
+}
+
+// GetLists returns the lists of the user and the lists shared with them, the
+// archived ones last.
+func (user *User) GetLists() ([]List, error) {
+	const funcErrMsg = "models.User.GetLists"
+
+	stmt, err := user.db.Prepare(listQuery + `
+		ORDER BY task_list.is_archived, task_list.name, task_list.id
+		`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.Query(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to query lists: %w", funcErrMsg, err)
+	}
+
+	defer rows.Close()
+
+	lists := []List{}
+
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to scan rows: %w", funcErrMsg, err)
+		}
+
+		lists = append(lists, list)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows error: %w", funcErrMsg, err)
+	}
+
+	return lists, nil
+}
+
+func (user *User) GetList(listID int) (List, error) {
+	const funcErrMsg = "models.User.GetList"
+
+	stmt, err := user.db.Prepare(listQuery + ` AND task_list.id = $2`)
+	if err != nil {
+		return List{}, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	list, err := scanList(stmt.QueryRow(user.ID, listID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return List{}, fmt.Errorf("%s: %w", funcErrMsg, ErrListNotFound)
+	}
+
+	if err != nil {
+		return List{}, fmt.Errorf("%s: failed to scan a query response: %w", funcErrMsg, err)
+	}
+
+	return list, nil
+}
+
+func (user *User) CreateList(name string) (List, error) {
+	const funcErrMsg = "models.User.CreateList"
+
+	name, err := validateListName(name)
+	if err != nil {
+		return List{}, err
+	}
+
+	stmt, err := user.db.Prepare(`
+		INSERT INTO task_list(user_id, name) VALUES ($1, $2)
+			RETURNING ` + listColumns + `
+		`)
+	if err != nil {
+		return List{}, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	list, err := user.scanOwnList(stmt.QueryRow(user.ID, name))
+	if isUniqueViolation(err) {
+		return List{}, ErrListAlreadyExist
+	}
+
+	if err != nil {
+		return List{}, fmt.Errorf("%s: failed to insert a list: %w", funcErrMsg, err)
+	}
+
+	return list, nil
+}
+
+// UpdateList renames, archives or restores a list of the user. The tasks of an
+// archived list are kept, but no task can be added to it. Only the owner can
+// change a list.
+func (user *User) UpdateList(listID int, update ListUpdate) (List, error) {
+	const funcErrMsg = "models.User.UpdateList"
+
+	if update.Name != nil {
+		name, err := validateListName(*update.Name)
+		if err != nil {
+			return List{}, err
+		}
+
+		update.Name = &name
+	}
+
+	stmt, err := user.db.Prepare(`
+		UPDATE task_list SET name = COALESCE($1::TEXT, name), is_archived = COALESCE($2::BOOLEAN, is_archived)
+			WHERE id = $3 AND user_id = $4
+			RETURNING ` + listColumns + `
+		`)
+	if err != nil {
+		return List{}, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	list, err := user.scanOwnList(stmt.QueryRow(update.Name, update.IsArchived, listID, user.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return List{}, fmt.Errorf("%s: %w", funcErrMsg, user.missingListError(listID))
+	}
+
+	if isUniqueViolation(err) {
+		return List{}, ErrListAlreadyExist
+	}
+
+	if err != nil {
+		return List{}, fmt.Errorf("%s: failed to update a list: %w", funcErrMsg, err)
+	}
+
+	return list, nil
+}
+
+// DeleteList deletes a list of the user together with its tasks. Only the
+// owner can delete a list.
+func (user *User) DeleteList(listID int) error {
+	const funcErrMsg = "models.User.DeleteList"
+
+	stmt, err := user.db.Prepare(`DELETE FROM task_list WHERE id = $1 AND user_id = $2`)
+	if err != nil {
+		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	result, err := stmt.Exec(listID, user.ID)
+	if err != nil {
+		return fmt.Errorf("%s: failed to execute a query: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", funcErrMsg, user.missingListError(listID))
+	}
+
+	return nil
+}
+
+// checkListOpen makes sure the user can put tasks into a list: they have to
+// own it or edit it, and it can't be archived.
+func (user *User) checkListOpen(listID int) error {
+	list, err := user.GetList(listID)
+	if err != nil {
+		return err
+	}
+
+	if !list.Role.CanEdit() {
+		return ErrPermissionDenied
+	}
+
+	if list.IsArchived {
+		return ErrListArchived
+	}
+
+	return nil
+}
+
+// missingListError tells a list the user can't see from one that only its
+// owner can change.
+func (user *User) missingListError(listID int) error {
+	_, err := user.GetList(listID)
+	if err != nil {
+		return err
+	}
+
+	return ErrPermissionDenied
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	loginAttemptsKeyPrefix = "login_attempts:"
+	loginLockoutKeyPrefix  = "login_lockout:"
+
+	LockoutScopeLogin = "login"
+	LockoutScopeIP    = "ip"
+)
+
+type LoginLimiterConfig struct {
+	MaxAttemptsPerLogin int
+	MaxAttemptsPerIP    int
+	AttemptsWindow      time.Duration
+	BaseLockout         time.Duration
+	MaxLockout          time.Duration
+}
+
+func DefaultLoginLimiterConfig() LoginLimiterConfig {
+	const (
+		maxAttemptsPerLogin = 5
+		maxAttemptsPerIP    = 20
+	)
+
+	return LoginLimiterConfig{
+		MaxAttemptsPerLogin: maxAttemptsPerLogin,
+		MaxAttemptsPerIP:    maxAttemptsPerIP,
+		AttemptsWindow:      15 * time.Minute,
+		BaseLockout:         30 * time.Second,
+		MaxLockout:          15 * time.Minute,
+	}
+}
+
+// LoginLimiter counts failed logins per login and per IP in Redis and locks
+// them out for an exponentially growing time once a limit is reached.
+type LoginLimiter struct {
+	rdb      redis.UniversalClient
+	config   LoginLimiterConfig
+	lockouts *prometheus.CounterVec
+}
+
+func NewLoginLimiter(
+	rdb redis.UniversalClient,
+	config LoginLimiterConfig,
+	lockouts *prometheus.CounterVec,
+) LoginLimiter {
+	return LoginLimiter{
+		rdb:      rdb,
+		config:   config,
+		lockouts: lockouts,
+	}
+}
+
+// Check returns how long the login or the IP is still locked out for.
+func (limiter *LoginLimiter) Check(login, ip string) (time.Duration, error) {
+	const funcErrMsg = "models.LoginLimiter.Check"
+
+	ctx := context.Background()
+
+	pipe := limiter.rdb.Pipeline()
+	loginTTL := pipe.PTTL(ctx, loginLockoutKeyPrefix+LockoutScopeLogin+":"+login)
+	ipTTL := pipe.PTTL(ctx, loginLockoutKeyPrefix+LockoutScopeIP+":"+ip)
+
+	_, err := pipe.Exec(ctx)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("%s: failed to get lockouts: %w", funcErrMsg, err)
+	}
+
+	return max(loginTTL.Val(), ipTTL.Val(), 0), nil
+}
+
+// RegisterFailure counts a failed attempt and returns the lockout it caused,
+// or zero if the limits aren't reached yet.
+func (limiter *LoginLimiter) RegisterFailure(login, ip string) (time.Duration, error) {
+	const funcErrMsg = "models.LoginLimiter.RegisterFailure"
+
+	loginLockout, err := limiter.registerFailure(
+		LockoutScopeLogin,
+		login,
+		limiter.config.MaxAttemptsPerLogin,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	ipLockout, err := limiter.registerFailure(LockoutScopeIP, ip, limiter.config.MaxAttemptsPerIP)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	return max(loginLockout, ipLockout), nil
+}
+
+// Reset forgets failed attempts of the login after it logged in successfully.
+func (limiter *LoginLimiter) Reset(login string) error {
+	const funcErrMsg = "models.LoginLimiter.Reset"
+
+	ctx := context.Background()
+
+	err := limiter.rdb.Del(
+		ctx,
+		loginAttemptsKeyPrefix+LockoutScopeLogin+":"+login,
+		loginLockoutKeyPrefix+LockoutScopeLogin+":"+login,
+	).Err()
+	if err != nil {
+		return fmt.Errorf("%s: failed to delete attempts: %w", funcErrMsg, err)
+	}
+
+	return nil
+}
+
+func (limiter *LoginLimiter) registerFailure(
+	scope, subject string,
+	maxAttempts int,
+) (time.Duration, error) {
+	const funcErrMsg = "models.LoginLimiter.registerFailure"
+
+	ctx := context.Background()
+
+	attemptsKey := loginAttemptsKeyPrefix + scope + ":" + subject
+
+	pipe := limiter.rdb.TxPipeline()
+	attempts := pipe.Incr(ctx, attemptsKey)
+	pipe.Expire(ctx, attemptsKey, limiter.config.AttemptsWindow)
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to count an attempt: %w", funcErrMsg, err)
+	}
+
+	overLimit := int(attempts.Val()) - maxAttempts
+	if overLimit < 0 {
+		return 0, nil
+	}
+
+	lockout := limiter.config.BaseLockout
+	for range overLimit {
+		lockout *= 2
+
+		if lockout >= limiter.config.MaxLockout {
+			lockout = limiter.config.MaxLockout
+
+			break
+		}
+	}
+
+	err = limiter.rdb.Set(ctx, loginLockoutKeyPrefix+scope+":"+subject, 1, lockout).Err()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to set a lockout: %w", funcErrMsg, err)
+	}
+
+	limiter.lockouts.WithLabelValues(scope).Inc()
+
+	return lockout, nil
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrInvalidOIDCState = errors.New("login request is invalid or has expired")
+
+const (
+	oidcStateKeyPrefix      = "oidc_state:"
+	oidcStateExpireDuration = 10 * time.Minute
+)
+
+// OIDCState is what we remember about a login between sending the browser to
+// the provider and its callback. LinkUserID is set when a logged in user links
+// an identity instead of logging in with it.
+type OIDCState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+	LinkUserID   int    `json:"linkUserId"`
+}
+
+// SetOIDCState stores the state and returns the value for the state parameter.
+// The same value is set in a cookie, so the callback only works in the browser
+// that started the login.
+func (store *SessionStore) SetOIDCState(
+	response *http.ResponseWriter,
+	key string,
+	state OIDCState,
+) (string, error) {
+	const errFuncMsg = "models.SessionStore.SetOIDCState"
+
+	token, err := NewToken()
+	if err != nil {
+		return "", fmt.Errorf("%s failed to create a token: %w", errFuncMsg, err)
+	}
+
+	value, err := json.Marshal(state)
+	if err != nil {
+		return "", fmt.Errorf("%s failed to encode state: %w", errFuncMsg, err)
+	}
+
+	ctx := context.Background()
+
+	err = store.rdb.Set(ctx, oidcStateKeyPrefix+HashToken(token), value, oidcStateExpireDuration).Err()
+	if err != nil {
+		return "", fmt.Errorf("%s failed to set state: %w", errFuncMsg, err)
+	}
+
+	http.SetCookie(*response, &http.Cookie{
+		Name:     key,
+		Value:    token,
+		MaxAge:   int(oidcStateExpireDuration.Seconds()),
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+	})
+
+	return token, nil
+}
+
+// TakeOIDCState returns the stored state if it matches the cookie and removes
+// it, so a callback can't be replayed.
+func (store *SessionStore) TakeOIDCState(
+	response *http.ResponseWriter,
+	request *http.Request,
+	key string,
+	stateToken string,
+) (OIDCState, error) {
+	const errFuncMsg = "models.SessionStore.TakeOIDCState"
+
+	http.SetCookie(*response, &http.Cookie{
+		Name:     key,
+		Value:    "",
+		MaxAge:   -1,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+	})
+
+	cookie, err := request.Cookie(key)
+	if err != nil || stateToken == "" {
+		return OIDCState{}, ErrInvalidOIDCState
+	}
+
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateToken)) != 1 {
+		return OIDCState{}, ErrInvalidOIDCState
+	}
+
+	ctx := context.Background()
+
+	value, err := store.rdb.GetDel(ctx, oidcStateKeyPrefix+HashToken(stateToken)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return OIDCState{}, ErrInvalidOIDCState
+	}
+
+	if err != nil {
+		return OIDCState{}, fmt.Errorf("%s failed to get state: %w", errFuncMsg, err)
+	}
+
+	state := OIDCState{}
+
+	err = json.Unmarshal(value, &state)
+	if err != nil {
+		return OIDCState{}, fmt.Errorf("%s failed to decode state: %w", errFuncMsg, err)
+	}
+
+	return state, nil
+}
@@ -1,9 +1,72 @@
 package models
 
+import (
+	"net/url"
+	"strconv"
+)
+
+// Page is a task list page: the Inbox when List is nil, or one of Lists.
 type Page struct {
-	Tasks Tasks
-	User  User
-	Form  FormData
+	Tasks    Tasks
+	User     User
+	Form     FormData
+	View     TaskView
+	Order    TaskOrder
+	Tag      string
+	List     *List
+	Lists    []List
+	ListForm FormData
+	Members  []ListMember
+}
+
+// Path is the URL of the list the page shows.
+func (p Page) Path() string {
+	if p.List == nil {
+		return "/"
+	}
+
+	return "/lists/" + strconv.Itoa(p.List.ID)
+}
+
+// Link returns the URL of the page with its filters, but with one of them
+// changed, so picking a view keeps the order and the tag.
+func (p Page) Link(filter, value string) string {
+	query := url.Values{}
+
+	for key, current := range map[string]string{
+		"view":  string(p.View),
+		"order": string(p.Order),
+		"tag":   p.Tag,
+	} {
+		if current != "" {
+			query.Set(key, current)
+		}
+	}
+
+	query.Del(filter)
+
+	if value != "" {
+		query.Set(filter, value)
+	}
+
+	if len(query) == 0 {
+		return p.Path()
+	}
+
+	return p.Path() + "?" + query.Encode()
+}
+
+// SharedLists returns the lists other users shared with the user of the page.
+func (p Page) SharedLists() []List {
+	shared := []List{}
+
+	for _, list := range p.Lists {
+		if list.Role != ListRoleOwner {
+			shared = append(shared, list)
+		}
+	}
+
+	return shared
 }
 
 func (p *Page) NewFormData() FormData {
@@ -24,8 +87,164 @@ func NewFormData() FormData {
 
 func NewPage(tasklist Tasks, user User) Page {
 	return Page{
-		Tasks: tasklist,
-		User:  user,
-		Form:  NewFormData(),
+		Tasks:    tasklist,
+		User:     user,
+		Form:     NewFormData(),
+		ListForm: NewFormData(),
+	}
+}
+
+// DueAtInputLayout is the format of a datetime-local input.
+const DueAtInputLayout = "2006-01-02T15:04"
+
+// TaskForm is the inline editor of a task. Lists are the lists it can be
+// moved to.
+type TaskForm struct {
+	Task  Task
+	Form  FormData
+	Lists []List
+}
+
+func NewTaskForm(task Task) TaskForm {
+	form := NewFormData()
+	form.Values["Title"] = task.Title
+
+	if task.ListID != nil {
+		form.Values["ListID"] = strconv.Itoa(*task.ListID)
+	}
+
+	if task.DueAt != nil {
+		form.Values["DueAt"] = task.DueAt.Format(DueAtInputLayout)
+	}
+
+	return TaskForm{
+		Task: task,
+		Form: form,
+	}
+}
+
+// SubtasksForm is the checklist of a task with the form that adds items to it.
+// Open keeps the checklist expanded after a change.
+type SubtasksForm struct {
+	Task Task
+	Form FormData
+	Open bool
+}
+
+func NewSubtasksForm(task Task) SubtasksForm {
+	return SubtasksForm{
+		Task: task,
+		Form: NewFormData(),
+	}
+}
+
+type SettingsPage struct {
+	User         User
+	PasswordForm FormData
+	EmailForm    FormData
+	TimeZoneForm FormData
+	TasksForm    FormData
+}
+
+func NewSettingsPage(user User) SettingsPage {
+	return SettingsPage{
+		User:         user,
+		PasswordForm: NewFormData(),
+		EmailForm:    NewFormData(),
+		TimeZoneForm: NewFormData(),
+		TasksForm:    NewFormData(),
+	}
+}
+
+type SessionsPage struct {
+	User             User
+	Sessions         []Session
+	CurrentSessionID string
+}
+
+func NewSessionsPage(user User, sessions []Session, currentSessionID string) SessionsPage {
+	return SessionsPage{
+		User:             user,
+		Sessions:         sessions,
+		CurrentSessionID: currentSessionID,
+	}
+}
+
+type APITokensPage struct {
+	User     User
+	Tokens   []APIToken
+	NewToken string
+	Form     FormData
+}
+
+func NewAPITokensPage(user User, tokens []APIToken) APITokensPage {
+	return APITokensPage{
+		User:   user,
+		Tokens: tokens,
+		Form:   NewFormData(),
+	}
+}
+
+type TagsPage struct {
+	User User
+	Tags []Tag
+	Form FormData
+}
+
+func NewTagsPage(user User, tags []Tag) TagsPage {
+	return TagsPage{
+		User: user,
+		Tags: tags,
+		Form: NewFormData(),
+	}
+}
+
+// TagForm is a row of the tags page, with the errors of its last edit.
+type TagForm struct {
+	Tag  Tag
+	Form FormData
+}
+
+func NewTagForm(tag Tag) TagForm {
+	return TagForm{
+		Tag:  tag,
+		Form: NewFormData(),
+	}
+}
+
+// ListForm is the header of a list page, which renames and archives it.
+type ListForm struct {
+	List List
+	Form FormData
+}
+
+func NewListForm(list List) ListForm {
+	form := NewFormData()
+	form.Values["Name"] = list.Name
+
+	return ListForm{
+		List: list,
+		Form: form,
+	}
+}
+
+// ListMembersForm shows who a list is shared with. Its owner shares the list
+// with the form, and UserID is the user reading it, who can leave the list.
+type ListMembersForm struct {
+	List    List
+	Members []ListMember
+	UserID  int
+	Form    FormData
+}
+
+func NewListMembersForm(list List, members []ListMember, userID int) ListMembersForm {
+	form := NewFormData()
+	form.Values["Role"] = string(ListRoleViewer)
+
+	return ListMembersForm{
+		List:    list,
+		Members: members,
+		UserID:  userID,
+		Form:    form,
 	}
 }
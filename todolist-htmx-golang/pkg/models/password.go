@@ -0,0 +1,263 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	HashAlgorithmBcrypt   = "bcrypt"
+	HashAlgorithmArgon2id = "argon2id"
+)
+
+var (
+	ErrUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMalformedHash        = errors.New("malformed password hash")
+)
+
+type PasswordHasherConfig struct {
+	Algorithm string
+
+	BcryptCost int
+
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+	Argon2KeyLen  uint32
+	Argon2SaltLen uint32
+}
+
+func DefaultPasswordHasherConfig() PasswordHasherConfig {
+	const (
+		argon2Time    = 1
+		argon2Memory  = 64 * 1024
+		argon2Threads = 4
+		argon2KeyLen  = 32
+		argon2SaltLen = 16
+	)
+
+	return PasswordHasherConfig{
+		Algorithm:     HashAlgorithmBcrypt,
+		BcryptCost:    bcrypt.DefaultCost,
+		Argon2Time:    argon2Time,
+		Argon2Memory:  argon2Memory,
+		Argon2Threads: argon2Threads,
+		Argon2KeyLen:  argon2KeyLen,
+		Argon2SaltLen: argon2SaltLen,
+	}
+}
+
+type PasswordHasher struct {
+	config PasswordHasherConfig
+}
+
+func NewPasswordHasher(config PasswordHasherConfig) (PasswordHasher, error) {
+	const funcErrMsg = "models.NewPasswordHasher"
+
+	switch config.Algorithm {
+	case HashAlgorithmBcrypt:
+		if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+			return PasswordHasher{}, fmt.Errorf(
+				"%s: bcrypt cost must be between %d and %d",
+				funcErrMsg,
+				bcrypt.MinCost,
+				bcrypt.MaxCost,
+			)
+		}
+	case HashAlgorithmArgon2id:
+		if config.Argon2Time == 0 || config.Argon2Memory == 0 || config.Argon2Threads == 0 {
+			return PasswordHasher{}, fmt.Errorf(
+				"%s: argon2id time, memory and threads must be positive",
+				funcErrMsg,
+			)
+		}
+	default:
+		return PasswordHasher{}, fmt.Errorf(
+			"%s: %q: %w",
+			funcErrMsg,
+			config.Algorithm,
+			ErrUnknownHashAlgorithm,
+		)
+	}
+
+	return PasswordHasher{config: config}, nil
+}
+
+// Hash returns an encoded hash of the password with the configured algorithm.
+func (hasher *PasswordHasher) Hash(password string) (string, error) {
+	const funcErrMsg = "models.PasswordHasher.Hash"
+
+	if hasher.config.Algorithm == HashAlgorithmArgon2id {
+		return hasher.hashArgon2id(password)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), hasher.config.BcryptCost)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to generate bcrypt hash: %w", funcErrMsg, err)
+	}
+
+	return string(hash), nil
+}
+
+// Verify reports whether the password matches the stored value. A stored value
+// that is not a recognised hash is treated as a legacy plaintext password.
+func (hasher *PasswordHasher) Verify(stored, password string) (bool, error) {
+	const funcErrMsg = "models.PasswordHasher.Verify"
+
+	switch {
+	case isBcryptHash(stored):
+		err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", funcErrMsg, err)
+		}
+
+		return true, nil
+	case isArgon2idHash(stored):
+		return verifyArgon2id(stored, password)
+	default:
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1, nil
+	}
+}
+
+// NeedsRehash reports whether the stored value should be replaced with a fresh
+// hash: it is plaintext, uses another algorithm or weaker parameters.
+func (hasher *PasswordHasher) NeedsRehash(stored string) bool {
+	switch hasher.config.Algorithm {
+	case HashAlgorithmBcrypt:
+		if !isBcryptHash(stored) {
+			return true
+		}
+
+		cost, err := bcrypt.Cost([]byte(stored))
+
+		return err != nil || cost != hasher.config.BcryptCost
+	case HashAlgorithmArgon2id:
+		if !isArgon2idHash(stored) {
+			return true
+		}
+
+		params, _, _, err := decodeArgon2id(stored)
+
+		return err != nil ||
+			params.time != hasher.config.Argon2Time ||
+			params.memory != hasher.config.Argon2Memory ||
+			params.threads != hasher.config.Argon2Threads
+	default:
+		return true
+	}
+}
+
+func isBcryptHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
+
+func isArgon2idHash(stored string) bool {
+	return strings.HasPrefix(stored, "$argon2id$")
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+func (hasher *PasswordHasher) hashArgon2id(password string) (string, error) {
+	const funcErrMsg = "models.PasswordHasher.hashArgon2id"
+
+	salt := make([]byte, hasher.config.Argon2SaltLen)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to generate a salt: %w", funcErrMsg, err)
+	}
+
+	key := argon2.IDKey(
+		[]byte(password),
+		salt,
+		hasher.config.Argon2Time,
+		hasher.config.Argon2Memory,
+		hasher.config.Argon2Threads,
+		hasher.config.Argon2KeyLen,
+	)
+
+	encoded := fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		hasher.config.Argon2Memory,
+		hasher.config.Argon2Time,
+		hasher.config.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return encoded, nil
+}
+
+func verifyArgon2id(stored, password string) (bool, error) {
+	const funcErrMsg = "models.verifyArgon2id"
+
+	params, salt, key, err := decodeArgon2id(stored)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	//nolint:gosec // key length comes from our own encoded hash
+	otherKey := argon2.IDKey(
+		[]byte(password),
+		salt,
+		params.time,
+		params.memory,
+		params.threads,
+		uint32(len(key)),
+	)
+
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+func decodeArgon2id(stored string) (argon2Params, []byte, []byte, error) {
+	const argon2idParts = 6
+
+	parts := strings.Split(stored, "$")
+	if len(parts) != argon2idParts {
+		return argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	params := argon2Params{}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+	if err != nil || params.memory == 0 || params.time == 0 || params.threads == 0 {
+		return argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	return params, salt, key, nil
+}
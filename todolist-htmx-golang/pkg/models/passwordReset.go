@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidResetToken = errors.New("reset link is invalid or has expired")
+
+const passwordResetTokenTTL = time.Hour
+
+// CreatePasswordResetToken returns a single-use token for the user. Only its
+// hash is stored, so the token itself exists only in the sent link.
+func (storage *UserStorage) CreatePasswordResetToken(userID int) (string, error) {
+	const funcErrMsg = "storage.UserStorage.CreatePasswordResetToken"
+
+	token, err := NewToken()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	const query = `
+		INSERT INTO password_reset_token(user_id, token_hash, expires_at)
+			VALUES ($1, $2, $3);
+		`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return "", fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userID, HashToken(token), time.Now().Add(passwordResetTokenTTL))
+	if err != nil {
+		return "", fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("created a password reset token", "id", userID)
+
+	return token, nil
+}
+
+func (storage *UserStorage) CheckPasswordResetToken(token string) error {
+	const funcErrMsg = "storage.UserStorage.CheckPasswordResetToken"
+
+	const query = `
+		SELECT user_id FROM password_reset_token
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now();
+		`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	var userID int
+
+	err = stmt.QueryRow(HashToken(token)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidResetToken
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s failed to scan a token: %w", funcErrMsg, err)
+	}
+
+	return nil
+}
+
+// ResetPassword spends the token, sets the new password and returns the ID of
+// the user, so the caller can revoke the user's sessions.
+func (storage *UserStorage) ResetPassword(token, newPassword string) (int, error) {
+	const funcErrMsg = "storage.UserStorage.ResetPassword"
+
+	if newPassword == "" {
+		return 0, ErrEmptyPassword
+	}
+
+	passwordHash, err := storage.hasher.Hash(newPassword)
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to hash a password: %w", funcErrMsg, err)
+	}
+
+	tx, err := storage.database.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to begin a transaction: %w", funcErrMsg, err)
+	}
+
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	var userID int
+
+	err = tx.QueryRow(`
+		UPDATE password_reset_token SET used_at = now()
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+			RETURNING user_id;
+		`, HashToken(token)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidResetToken
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to use a token: %w", funcErrMsg, err)
+	}
+
+	_, err = tx.Exec(`UPDATE "user" SET password = $1 WHERE id = $2`, passwordHash, userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to set a password: %w", funcErrMsg, err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE password_reset_token SET used_at = now()
+			WHERE user_id = $1 AND used_at IS NULL;
+		`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to expire other tokens: %w", funcErrMsg, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("%s failed to commit a transaction: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("reset a password", "id", userID)
+
+	return userID, nil
+}
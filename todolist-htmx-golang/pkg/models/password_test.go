@@ -0,0 +1,37 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRejectsArgon2idHashesWithoutCost(t *testing.T) {
+	hasher, err := NewPasswordHasher(PasswordHasherConfig{
+		Algorithm:     HashAlgorithmArgon2id,
+		Argon2Time:    1,
+		Argon2Memory:  1024,
+		Argon2Threads: 1,
+		Argon2KeyLen:  32,
+		Argon2SaltLen: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := hasher.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, params := range []string{"m=0,t=1,p=1", "m=1024,t=0,p=1", "m=1024,t=1,p=0"} {
+		t.Run(params, func(t *testing.T) {
+			tampered := strings.Replace(stored, "m=1024,t=1,p=1", params, 1)
+
+			isValid, err := hasher.Verify(tampered, "password")
+			if !errors.Is(err, ErrMalformedHash) {
+				t.Errorf("Verify(%q) = %v, %v, want %v", tampered, isValid, err, ErrMalformedHash)
+			}
+		})
+	}
+}
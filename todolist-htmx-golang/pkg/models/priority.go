@@ -0,0 +1,59 @@
+package models
+
+type Priority int
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+	PriorityUrgent
+)
+
+// Priorities lists every priority from the lowest to the highest, the order
+// pickers show them in.
+var Priorities = []Priority{PriorityNone, PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+
+var priorityNames = map[Priority]string{
+	PriorityNone:   "none",
+	PriorityLow:    "low",
+	PriorityMedium: "medium",
+	PriorityHigh:   "high",
+	PriorityUrgent: "urgent",
+}
+
+func ParsePriority(name string) (Priority, error) {
+	for priority, priorityName := range priorityNames {
+		if priorityName == name {
+			return priority, nil
+		}
+	}
+
+	return PriorityNone, ErrInvalidPriority
+}
+
+func (priority Priority) isValid() bool {
+	_, isKnown := priorityNames[priority]
+
+	return isKnown
+}
+
+func (priority Priority) String() string {
+	return priorityNames[priority]
+}
+
+// MarshalText makes JSON carry the name of a priority instead of its number.
+func (priority Priority) MarshalText() ([]byte, error) {
+	return []byte(priority.String()), nil
+}
+
+func (priority *Priority) UnmarshalText(text []byte) error {
+	parsed, err := ParsePriority(string(text))
+	if err != nil {
+		return err
+	}
+
+	*priority = parsed
+
+	return nil
+}
@@ -2,10 +2,12 @@ package models
 
 import (
 	"context"
-	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -16,6 +18,26 @@ var (
 	ErrBadRequest      = errors.New("bad request")
 )
 
+const (
+	sessionKeyPrefix       = "session:"
+	userSessionsKeyPrefix  = "user_sessions:"
+	sessionExpireDuration  = 24 * time.Hour
+	sessionLastSeenRefresh = time.Minute
+
+	pendingSessionKeyPrefix      = "pending_session:"
+	pendingSessionExpireDuration = 5 * time.Minute
+)
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"userId"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	CSRFToken  string    `json:"csrfToken"`
+}
+
 func NewSessionStore(rdb redis.UniversalClient) SessionStore {
 	return SessionStore{
 		rdb: rdb,
@@ -26,39 +48,96 @@ type SessionStore struct {
 	rdb redis.UniversalClient
 }
 
-func (store *SessionStore) GetSession(request *http.Request, key string) (string, error) {
+func (store *SessionStore) GetSession(request *http.Request, key string) (Session, error) {
 	const errFuncMsg = "models.SessionStore.GetSession"
 
 	cookie, err := request.Cookie(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to get cookie: %w", ErrBadRequest)
+		return Session{}, fmt.Errorf("failed to get cookie: %w", ErrBadRequest)
 	}
 
 	ctx := context.Background()
 
-	value, err := store.rdb.Get(ctx, cookie.Value).Result()
+	sessionKey := sessionKeyPrefix + HashToken(cookie.Value)
+
+	value, err := store.rdb.Get(ctx, sessionKey).Bytes()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return "", ErrSessionNotFound
+			return Session{}, ErrSessionNotFound
 		}
 
-		return "", fmt.Errorf("%s failed to get session: %w", errFuncMsg, err)
+		return Session{}, fmt.Errorf("%s failed to get session: %w", errFuncMsg, err)
+	}
+
+	session := Session{}
+
+	err = json.Unmarshal(value, &session)
+	if err != nil {
+		return Session{}, fmt.Errorf("%s failed to decode session: %w", errFuncMsg, err)
+	}
+
+	now := time.Now()
+
+	if now.Sub(session.LastSeenAt) > sessionLastSeenRefresh {
+		session.LastSeenAt = now
+
+		err = store.saveSession(ctx, session, redis.KeepTTL)
+		if err != nil {
+			return Session{}, fmt.Errorf("%s failed to refresh session: %w", errFuncMsg, err)
+		}
 	}
 
-	return value, nil
+	return session, nil
 }
 
-func (store *SessionStore) SetSession(response *http.ResponseWriter, key string, val string) error {
+// SetSession starts a new session for session.UserID. A random token is sent
+// in the cookie and only its hash is used as the session ID in Redis.
+func (store *SessionStore) SetSession(
+	response *http.ResponseWriter,
+	key string,
+	session Session,
+) error {
 	const errFuncMsg = "models.SessionStore.SetSession"
 
-	encodedValue := base64.StdEncoding.EncodeToString([]byte(val))
+	token, err := NewToken()
+	if err != nil {
+		return fmt.Errorf("%s failed to create a token: %w", errFuncMsg, err)
+	}
 
-	const expireDuration = 24 * time.Hour
+	csrfToken, err := NewToken()
+	if err != nil {
+		return fmt.Errorf("%s failed to create a csrf token: %w", errFuncMsg, err)
+	}
+
+	now := time.Now()
+
+	session.ID = HashToken(token)
+	session.CSRFToken = csrfToken
+	session.CreatedAt = now
+	session.LastSeenAt = now
+
+	ctx := context.Background()
+
+	err = store.saveSession(ctx, session, sessionExpireDuration)
+	if err != nil {
+		return fmt.Errorf("%s failed to set session: %w", errFuncMsg, err)
+	}
+
+	userSessionsKey := userSessionsKey(session.UserID)
+
+	pipe := store.rdb.TxPipeline()
+	pipe.SAdd(ctx, userSessionsKey, session.ID)
+	pipe.Expire(ctx, userSessionsKey, sessionExpireDuration)
+
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("%s failed to index session: %w", errFuncMsg, err)
+	}
 
 	cookie := &http.Cookie{
 		Name:     key,
-		Value:    encodedValue,
-		Expires:  time.Now().Add(expireDuration),
+		Value:    token,
+		Expires:  now.Add(sessionExpireDuration),
 		Path:     "/",
 		SameSite: http.SameSiteLaxMode,
 		HttpOnly: true,
@@ -66,12 +145,271 @@ func (store *SessionStore) SetSession(response *http.ResponseWriter, key string,
 
 	http.SetCookie(*response, cookie)
 
+	return nil
+}
+
+func (store *SessionStore) saveSession(
+	ctx context.Context,
+	session Session,
+	expiration time.Duration,
+) error {
+	const errFuncMsg = "models.SessionStore.saveSession"
+
+	value, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("%s failed to encode session: %w", errFuncMsg, err)
+	}
+
+	_, err = store.rdb.Set(ctx, sessionKeyPrefix+session.ID, value, expiration).Result()
+	if err != nil {
+		return fmt.Errorf("%s failed to save session: %w", errFuncMsg, err)
+	}
+
+	return nil
+}
+
+// DeleteSession ends the session of the request and clears its cookie.
+func (store *SessionStore) DeleteSession(
+	response *http.ResponseWriter,
+	request *http.Request,
+	key string,
+) error {
+	const errFuncMsg = "models.SessionStore.DeleteSession"
+
+	http.SetCookie(*response, &http.Cookie{
+		Name:     key,
+		Value:    "",
+		MaxAge:   -1,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+	})
+
+	session, err := store.GetSession(request, key)
+	if err != nil {
+		return fmt.Errorf("%s failed to get session: %w", errFuncMsg, err)
+	}
+
+	err = store.RevokeSession(session.UserID, session.ID)
+	if err != nil {
+		return fmt.Errorf("%s failed to revoke session: %w", errFuncMsg, err)
+	}
+
+	return nil
+}
+
+// RevokeSession ends one of the user's sessions by its ID.
+func (store *SessionStore) RevokeSession(userID int, sessionID string) error {
+	const errFuncMsg = "models.SessionStore.RevokeSession"
+
 	ctx := context.Background()
 
-	_, err := store.rdb.Set(ctx, encodedValue, val, expireDuration).Result()
+	userSessionsKey := userSessionsKey(userID)
+
+	isMember, err := store.rdb.SIsMember(ctx, userSessionsKey, sessionID).Result()
 	if err != nil {
-		return fmt.Errorf("%s failed to set session: %w", errFuncMsg, err)
+		return fmt.Errorf("%s failed to check session owner: %w", errFuncMsg, err)
+	}
+
+	if !isMember {
+		return ErrSessionNotFound
+	}
+
+	pipe := store.rdb.TxPipeline()
+	pipe.Del(ctx, sessionKeyPrefix+sessionID)
+	pipe.SRem(ctx, userSessionsKey, sessionID)
+
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("%s failed to delete session: %w", errFuncMsg, err)
 	}
 
 	return nil
 }
+
+// RevokeAllSessions ends every session of the user except exceptSessionID,
+// which may be empty to sign out everywhere.
+func (store *SessionStore) RevokeAllSessions(userID int, exceptSessionID string) error {
+	const errFuncMsg = "models.SessionStore.RevokeAllSessions"
+
+	ctx := context.Background()
+
+	userSessionsKey := userSessionsKey(userID)
+
+	sessionIDs, err := store.rdb.SMembers(ctx, userSessionsKey).Result()
+	if err != nil {
+		return fmt.Errorf("%s failed to get user sessions: %w", errFuncMsg, err)
+	}
+
+	pipe := store.rdb.TxPipeline()
+
+	for _, sessionID := range sessionIDs {
+		if sessionID == exceptSessionID {
+			continue
+		}
+
+		pipe.Del(ctx, sessionKeyPrefix+sessionID)
+		pipe.SRem(ctx, userSessionsKey, sessionID)
+	}
+
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("%s failed to delete sessions: %w", errFuncMsg, err)
+	}
+
+	return nil
+}
+
+// GetUserSessions returns the user's active sessions, most recently used first.
+func (store *SessionStore) GetUserSessions(userID int) ([]Session, error) {
+	const errFuncMsg = "models.SessionStore.GetUserSessions"
+
+	ctx := context.Background()
+
+	userSessionsKey := userSessionsKey(userID)
+
+	sessionIDs, err := store.rdb.SMembers(ctx, userSessionsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to get user sessions: %w", errFuncMsg, err)
+	}
+
+	if len(sessionIDs) == 0 {
+		return []Session{}, nil
+	}
+
+	sessionKeys := make([]string, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		sessionKeys = append(sessionKeys, sessionKeyPrefix+sessionID)
+	}
+
+	values, err := store.rdb.MGet(ctx, sessionKeys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to get sessions: %w", errFuncMsg, err)
+	}
+
+	sessions := make([]Session, 0, len(values))
+	expiredIDs := []any{}
+
+	for i, value := range values {
+		encoded, isString := value.(string)
+		if !isString {
+			expiredIDs = append(expiredIDs, sessionIDs[i])
+
+			continue
+		}
+
+		session := Session{}
+
+		err = json.Unmarshal([]byte(encoded), &session)
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to decode session: %w", errFuncMsg, err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if len(expiredIDs) != 0 {
+		err = store.rdb.SRem(ctx, userSessionsKey, expiredIDs...).Err()
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to remove expired sessions: %w", errFuncMsg, err)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+// SetPendingSession remembers a user who passed the password check but still
+// has to enter a second factor before a real session is created.
+func (store *SessionStore) SetPendingSession(
+	response *http.ResponseWriter,
+	key string,
+	userID int,
+) error {
+	const errFuncMsg = "models.SessionStore.SetPendingSession"
+
+	token, err := NewToken()
+	if err != nil {
+		return fmt.Errorf("%s failed to create a token: %w", errFuncMsg, err)
+	}
+
+	ctx := context.Background()
+
+	pendingKey := pendingSessionKeyPrefix + HashToken(token)
+
+	err = store.rdb.Set(ctx, pendingKey, userID, pendingSessionExpireDuration).Err()
+	if err != nil {
+		return fmt.Errorf("%s failed to set pending session: %w", errFuncMsg, err)
+	}
+
+	http.SetCookie(*response, &http.Cookie{
+		Name:     key,
+		Value:    token,
+		MaxAge:   int(pendingSessionExpireDuration.Seconds()),
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+	})
+
+	return nil
+}
+
+func (store *SessionStore) GetPendingSession(request *http.Request, key string) (int, error) {
+	const errFuncMsg = "models.SessionStore.GetPendingSession"
+
+	cookie, err := request.Cookie(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get cookie: %w", ErrBadRequest)
+	}
+
+	ctx := context.Background()
+
+	userID, err := store.rdb.Get(ctx, pendingSessionKeyPrefix+HashToken(cookie.Value)).Int()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, ErrSessionNotFound
+		}
+
+		return 0, fmt.Errorf("%s failed to get pending session: %w", errFuncMsg, err)
+	}
+
+	return userID, nil
+}
+
+func (store *SessionStore) DeletePendingSession(
+	response *http.ResponseWriter,
+	request *http.Request,
+	key string,
+) error {
+	const errFuncMsg = "models.SessionStore.DeletePendingSession"
+
+	http.SetCookie(*response, &http.Cookie{
+		Name:     key,
+		Value:    "",
+		MaxAge:   -1,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+	})
+
+	cookie, err := request.Cookie(key)
+	if err != nil {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	err = store.rdb.Del(ctx, pendingSessionKeyPrefix+HashToken(cookie.Value)).Err()
+	if err != nil {
+		return fmt.Errorf("%s failed to delete pending session: %w", errFuncMsg, err)
+	}
+
+	return nil
+}
+
+func userSessionsKey(userID int) string {
+	return userSessionsKeyPrefix + strconv.Itoa(userID)
+}
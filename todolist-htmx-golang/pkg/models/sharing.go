@@ -0,0 +1,214 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ListRole is what a user can do with a list: its owner and editors change
+// its tasks, viewers only read them.
+type ListRole string
+
+const (
+	ListRoleOwner  ListRole = "owner"
+	ListRoleEditor ListRole = "editor"
+	ListRoleViewer ListRole = "viewer"
+)
+
+// ParseListRole parses the role a list is shared with, which is never owner.
+func ParseListRole(role string) (ListRole, error) {
+	switch listRole := ListRole(role); listRole {
+	case ListRoleEditor, ListRoleViewer:
+		return listRole, nil
+	default:
+		return ListRoleViewer, ErrInvalidListRole
+	}
+}
+
+func (role ListRole) CanEdit() bool {
+	return role == ListRoleOwner || role == ListRoleEditor
+}
+
+type ListMember struct {
+	UserID int      `json:"userId"`
+	Login  string   `json:"login"`
+	Role   ListRole `json:"role"`
+}
+
+// canAccessTask is an SQL condition on a task row that holds when the user
+// whose id is userParam can read the task, or change it when forEdit is set.
+// Inbox tasks belong to the user who created them, and the tasks of a list to
+// its owner and members.
+func canAccessTask(userParam string, forEdit bool) string {
+	memberRoles := `'viewer', 'editor'`
+	if forEdit {
+		memberRoles = `'editor'`
+	}
+
+	return `((task.list_id IS NULL AND EXISTS (
+			SELECT 1 FROM user_task WHERE user_task.task_id = task.id AND user_task.user_id = ` + userParam + `))
+		OR task.list_id IN (
+			SELECT task_list.id FROM task_list WHERE task_list.user_id = ` + userParam + `
+			UNION SELECT task_list_member.list_id FROM task_list_member
+				WHERE task_list_member.user_id = ` + userParam + `
+				AND task_list_member.role IN (` + memberRoles + `)))`
+}
+
+// missingTaskError tells a task the user can't see from one they can only
+// read.
+func (user *User) missingTaskError(taskID int) error {
+	_, err := user.GetTaskByID(taskID)
+	if err != nil {
+		return err
+	}
+
+	return ErrPermissionDenied
+}
+
+// GetListMembers returns the users a list is shared with. Every member can see
+// who else is in the list.
+func (user *User) GetListMembers(listID int) ([]ListMember, error) {
+	const funcErrMsg = "models.User.GetListMembers"
+
+	_, err := user.GetList(listID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	stmt, err := user.db.Prepare(`
+		SELECT "user".id, "user".login, task_list_member.role FROM task_list_member
+			JOIN "user" ON "user".id = task_list_member.user_id
+			WHERE task_list_member.list_id = $1
+			ORDER BY "user".login
+		`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.Query(listID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to query members: %w", funcErrMsg, err)
+	}
+
+	defer rows.Close()
+
+	members := []ListMember{}
+
+	for rows.Next() {
+		member := ListMember{}
+
+		err := rows.Scan(&member.UserID, &member.Login, &member.Role)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to scan rows: %w", funcErrMsg, err)
+		}
+
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows error: %w", funcErrMsg, err)
+	}
+
+	return members, nil
+}
+
+// ShareList gives the registered user with the login a role in a list of the
+// user, or changes the role they already have.
+func (user *User) ShareList(listID int, login string, role ListRole) (ListMember, error) {
+	const funcErrMsg = "models.User.ShareList"
+
+	if role != ListRoleEditor && role != ListRoleViewer {
+		return ListMember{}, ErrInvalidListRole
+	}
+
+	login = strings.TrimSpace(login)
+	if login == user.Login {
+		return ListMember{}, ErrCannotShareWithOwner
+	}
+
+	const query = `
+		INSERT INTO task_list_member(list_id, user_id, role)
+			SELECT task_list.id, member.id, $3 FROM task_list
+				JOIN "user" AS member ON member.login = $2
+				WHERE task_list.id = $1 AND task_list.user_id = $4 AND member.id <> $4
+			ON CONFLICT (list_id, user_id) DO UPDATE SET role = EXCLUDED.role
+			RETURNING user_id;
+		`
+
+	stmt, err := user.db.Prepare(query)
+	if err != nil {
+		return ListMember{}, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	member := ListMember{Login: login, Role: role}
+
+	err = stmt.QueryRow(listID, login, role, user.ID).Scan(&member.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ListMember{}, fmt.Errorf("%s: %w", funcErrMsg, user.missingMemberError(listID, ErrUserNotFound))
+	}
+
+	if err != nil {
+		return ListMember{}, fmt.Errorf("%s: failed to share a list: %w", funcErrMsg, err)
+	}
+
+	user.log.Info("Shared a list", "listID", listID, "memberID", member.UserID, "role", role)
+
+	return member, nil
+}
+
+// RemoveListMember revokes the access of a member to a list. The owner can
+// remove anyone, and a member can leave the list.
+func (user *User) RemoveListMember(listID, memberID int) error {
+	const funcErrMsg = "models.User.RemoveListMember"
+
+	const query = `
+		DELETE FROM task_list_member USING task_list
+			WHERE task_list_member.list_id = task_list.id
+			AND task_list_member.list_id = $1 AND task_list_member.user_id = $2
+			AND (task_list.user_id = $3 OR task_list_member.user_id = $3);
+		`
+
+	stmt, err := user.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	result, err := stmt.Exec(listID, memberID, user.ID)
+	if err != nil {
+		return fmt.Errorf("%s: failed to execute a query: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", funcErrMsg, user.missingMemberError(listID, ErrListMemberNotFound))
+	}
+
+	return nil
+}
+
+// missingMemberError explains why a change to the members of a list did
+// nothing: the list is gone, the user isn't its owner, or ownerErr.
+func (user *User) missingMemberError(listID int, ownerErr error) error {
+	list, err := user.GetList(listID)
+	if err != nil {
+		return err
+	}
+
+	if list.Role != ListRoleOwner {
+		return ErrPermissionDenied
+	}
+
+	return ownerErr
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+const maxSubtaskTitleLength = 200
+
+// Subtask is an item of the checklist of a task.
+type Subtask struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	IsDone bool   `json:"isDone"`
+}
+
+// DoneSubtasks returns how many items of the checklist of the task are done.
+func (task Task) DoneSubtasks() int {
+	done := 0
+
+	for _, subtask := range task.Subtasks {
+		if subtask.IsDone {
+			done++
+		}
+	}
+
+	return done
+}
+
+func validateSubtaskTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+
+	if title == "" {
+		return "", ErrEmptySubtaskTitle
+	}
+
+	if utf8.RuneCountInString(title) > maxSubtaskTitleLength {
+		return "", ErrSubtaskTitleTooLong
+	}
+
+	return title, nil
+}
+
+// AddSubtask puts a new item at the end of the checklist of a task the user
+// can change.
+func (user *User) AddSubtask(taskID int, title string) (Subtask, error) {
+	const funcErrMsg = "models.User.AddSubtask"
+
+	title, err := validateSubtaskTitle(title)
+	if err != nil {
+		return Subtask{}, err
+	}
+
+	query := `
+		INSERT INTO subtask(task_id, title)
+			SELECT task.id, $2 FROM task WHERE task.id = $1 AND ` + canAccessTask("$3", true) + `
+			RETURNING id;
+		`
+
+	stmt, err := user.db.Prepare(query)
+	if err != nil {
+		return Subtask{}, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	subtask := Subtask{Title: title}
+
+	err = stmt.QueryRow(taskID, title, user.ID).Scan(&subtask.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Subtask{}, fmt.Errorf("%s: %w", funcErrMsg, user.missingTaskError(taskID))
+	}
+
+	if err != nil {
+		return Subtask{}, fmt.Errorf("%s: failed to insert a checklist item: %w", funcErrMsg, err)
+	}
+
+	return subtask, nil
+}
+
+// SetSubtaskDoneStatus checks or unchecks an item of the checklist of a task.
+// Checking the last open item completes the task when the owner of the task,
+// who owns its list or has it in their Inbox, has AutoCompleteTasks on, so
+// every member of a shared list sees the same behavior.
+func (user *User) SetSubtaskDoneStatus(taskID, subtaskID int, isDone bool) error {
+	const funcErrMsg = "models.User.SetSubtaskDoneStatus"
+
+	tx, err := user.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: failed to begin a transaction: %w", funcErrMsg, err)
+	}
+
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	result, err := tx.Exec(`
+		UPDATE subtask SET is_done = $1 FROM task
+			WHERE subtask.task_id = task.id AND subtask.id = $2 AND task.id = $3
+			AND `+canAccessTask("$4", true),
+		isDone,
+		subtaskID,
+		taskID,
+		user.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: failed to execute a query: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", funcErrMsg, user.missingSubtaskError(taskID))
+	}
+
+	if isDone {
+		_, err = tx.Exec(`
+			UPDATE task SET is_done = TRUE
+				WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM subtask WHERE task_id = $1 AND NOT is_done)
+				AND (SELECT auto_complete_tasks FROM "user" WHERE "user".id = COALESCE(
+					(SELECT task_list.user_id FROM task_list WHERE task_list.id = task.list_id),
+					(SELECT user_task.user_id FROM user_task WHERE user_task.task_id = task.id LIMIT 1)))
+			`,
+			taskID,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: failed to complete a task: %w", funcErrMsg, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("%s: failed to commit a transaction: %w", funcErrMsg, err)
+	}
+
+	return nil
+}
+
+// RemoveSubtask deletes an item from the checklist of a task.
+func (user *User) RemoveSubtask(taskID, subtaskID int) error {
+	const funcErrMsg = "models.User.RemoveSubtask"
+
+	query := `
+		DELETE FROM subtask USING task
+			WHERE subtask.task_id = task.id AND subtask.id = $1 AND task.id = $2
+			AND ` + canAccessTask("$3", true)
+
+	stmt, err := user.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	result, err := stmt.Exec(subtaskID, taskID, user.ID)
+	if err != nil {
+		return fmt.Errorf("%s: failed to execute a query: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", funcErrMsg, user.missingSubtaskError(taskID))
+	}
+
+	return nil
+}
+
+// missingSubtaskError tells a checklist item that doesn't exist from one of a
+// task the user can't see or can only read.
+func (user *User) missingSubtaskError(taskID int) error {
+	task, err := user.GetTaskByID(taskID)
+	if err != nil {
+		return err
+	}
+
+	if !task.CanEdit {
+		return ErrPermissionDenied
+	}
+
+	return ErrSubtaskNotFound
+}
+
+// loadSubtasks fills in the checklists of the tasks, in the order the items
+// were added.
+func (user *User) loadSubtasks(tasks Tasks) error {
+	const funcErrMsg = "models.User.loadSubtasks"
+
+	taskIndexes := make(map[int]int, len(tasks))
+	taskIDs := make([]int64, len(tasks))
+
+	for i := range tasks {
+		tasks[i].Subtasks = []Subtask{}
+		taskIndexes[tasks[i].ID] = i
+		taskIDs[i] = int64(tasks[i].ID)
+	}
+
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	const query = `
+		SELECT task_id, id, title, is_done FROM subtask
+			WHERE task_id = ANY($1)
+			ORDER BY created_at, id;
+		`
+
+	stmt, err := user.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.Query(pq.Array(taskIDs))
+	if err != nil {
+		return fmt.Errorf("%s: failed to query checklist items: %w", funcErrMsg, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			taskID  int
+			subtask Subtask
+		)
+
+		err := rows.Scan(&taskID, &subtask.ID, &subtask.Title, &subtask.IsDone)
+		if err != nil {
+			return fmt.Errorf("%s: failed to scan rows: %w", funcErrMsg, err)
+		}
+
+		index := taskIndexes[taskID]
+		tasks[index].Subtasks = append(tasks[index].Subtasks, subtask)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: rows error: %w", funcErrMsg, err)
+	}
+
+	return nil
+}
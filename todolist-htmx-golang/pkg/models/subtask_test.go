@@ -0,0 +1,51 @@
+package models
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetSubtaskDoneStatusQueriesTheOwnerSetting(t *testing.T) {
+	// Checking an item runs the completion query whatever the setting of the
+	// editor is; the query itself reads auto_complete_tasks of the owner of
+	// the list, or of the Inbox, the task is in.
+	ownerCompletion := regexp.QuoteMeta(`UPDATE task SET is_done = TRUE`) + `(?s).*` +
+		regexp.QuoteMeta(`SELECT auto_complete_tasks FROM "user"`) + `.*` +
+		regexp.QuoteMeta(`SELECT task_list.user_id FROM task_list WHERE task_list.id = task.list_id`) + `.*` +
+		regexp.QuoteMeta(`SELECT user_task.user_id FROM user_task`)
+
+	tests := []struct {
+		name           string
+		memberSetting  bool
+		isDone         bool
+		wantCompletion bool
+	}{
+		{"editor without auto-completion checks an item", false, true, true},
+		{"editor unchecks an item", true, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			editor, mock := newMockUser(t, 2)
+			editor.AutoCompleteTasks = test.memberSetting
+
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE subtask SET is_done = $1")).
+				WithArgs(test.isDone, 5, 7, 2).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			if test.wantCompletion {
+				mock.ExpectExec(ownerCompletion).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			mock.ExpectCommit()
+
+			err := editor.SetSubtaskDoneStatus(7, 5, test.isDone)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
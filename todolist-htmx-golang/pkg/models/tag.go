@@ -0,0 +1,389 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+type Tag struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+const maxTagNameLength = 32
+
+// TagColors are the colors a tag chip can have. New tags get one picked from
+// their name, so the same name always starts with the same color.
+var TagColors = []string{"gray", "red", "orange", "yellow", "green", "blue", "purple", "pink"}
+
+var (
+	tagNamePattern  = regexp.MustCompile(`^\p{L}[\p{L}\p{N}_-]*$`)
+	titleTagPattern = regexp.MustCompile(`(^|\s)#(\p{L}[\p{L}\p{N}_-]*)`)
+)
+
+// ParseTitleTags takes the #tags out of a task title, so "Call Bob #work" is
+// the task "Call Bob" tagged "work". Tag names come back lower cased and
+// without duplicates.
+func ParseTitleTags(title string) (string, []string) {
+	names := []string{}
+
+	for _, match := range titleTagPattern.FindAllStringSubmatch(title, -1) {
+		name := strings.ToLower(match[2])
+		if utf8.RuneCountInString(name) <= maxTagNameLength && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	title = titleTagPattern.ReplaceAllString(title, "$1")
+
+	return strings.Join(strings.Fields(title), " "), names
+}
+
+// NormalizeTagName lower cases a tag name and drops the # in front of it.
+func NormalizeTagName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+
+	if !tagNamePattern.MatchString(name) || utf8.RuneCountInString(name) > maxTagNameLength {
+		return "", ErrInvalidTagName
+	}
+
+	return name, nil
+}
+
+func normalizeTagNames(names []string) ([]string, error) {
+	normalized := make([]string, 0, len(names))
+
+	for _, name := range names {
+		name, err := NormalizeTagName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !slices.Contains(normalized, name) {
+			normalized = append(normalized, name)
+		}
+	}
+
+	return normalized, nil
+}
+
+func defaultTagColor(name string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+
+	return TagColors[hash.Sum32()%uint32(len(TagColors))]
+}
+
+func (user *User) GetTags() ([]Tag, error) {
+	const funcErrMsg = "models.User.GetTags"
+
+	stmt, err := user.db.Prepare(`SELECT id, name, color FROM tag WHERE user_id = $1 ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.Query(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to query tags: %w", funcErrMsg, err)
+	}
+
+	defer rows.Close()
+
+	tags := []Tag{}
+
+	for rows.Next() {
+		tag := Tag{}
+
+		err := rows.Scan(&tag.ID, &tag.Name, &tag.Color)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to scan rows: %w", funcErrMsg, err)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows error: %w", funcErrMsg, err)
+	}
+
+	return tags, nil
+}
+
+func (user *User) CreateTag(name string) (Tag, error) {
+	const funcErrMsg = "models.User.CreateTag"
+
+	name, err := NormalizeTagName(name)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	stmt, err := user.db.Prepare(
+		`INSERT INTO tag(user_id, name, color) VALUES ($1, $2, $3) RETURNING id, name, color`,
+	)
+	if err != nil {
+		return Tag{}, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	tag := Tag{}
+
+	err = stmt.QueryRow(user.ID, name, defaultTagColor(name)).Scan(&tag.ID, &tag.Name, &tag.Color)
+	if isUniqueViolation(err) {
+		return Tag{}, ErrTagAlreadyExist
+	}
+
+	if err != nil {
+		return Tag{}, fmt.Errorf("%s: failed to insert a tag: %w", funcErrMsg, err)
+	}
+
+	return tag, nil
+}
+
+// UpdateTag renames and recolors a tag of the user; the tasks keep it.
+func (user *User) UpdateTag(tagID int, name, color string) (Tag, error) {
+	const funcErrMsg = "models.User.UpdateTag"
+
+	name, err := NormalizeTagName(name)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	if !slices.Contains(TagColors, color) {
+		return Tag{}, ErrInvalidTagColor
+	}
+
+	const query = `
+		UPDATE tag SET name = $1, color = $2
+			WHERE id = $3 AND user_id = $4
+			RETURNING id, name, color;
+		`
+
+	stmt, err := user.db.Prepare(query)
+	if err != nil {
+		return Tag{}, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	tag := Tag{}
+
+	err = stmt.QueryRow(name, color, tagID, user.ID).Scan(&tag.ID, &tag.Name, &tag.Color)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tag{}, fmt.Errorf("%s: %w", funcErrMsg, ErrTagNotFound)
+	}
+
+	if isUniqueViolation(err) {
+		return Tag{}, ErrTagAlreadyExist
+	}
+
+	if err != nil {
+		return Tag{}, fmt.Errorf("%s: failed to update a tag: %w", funcErrMsg, err)
+	}
+
+	return tag, nil
+}
+
+// DeleteTag removes a tag of the user from every task and then deletes it.
+func (user *User) DeleteTag(tagID int) error {
+	const funcErrMsg = "models.User.DeleteTag"
+
+	stmt, err := user.db.Prepare(`DELETE FROM tag WHERE id = $1 AND user_id = $2`)
+	if err != nil {
+		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	result, err := stmt.Exec(tagID, user.ID)
+	if err != nil {
+		return fmt.Errorf("%s: failed to execute a query: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", funcErrMsg, ErrTagNotFound)
+	}
+
+	return nil
+}
+
+// RemoveTaskTag takes a tag off a task. The tag has to belong to the user and
+// the user has to be allowed to change the task.
+func (user *User) RemoveTaskTag(taskID, tagID int) error {
+	const funcErrMsg = "models.User.RemoveTaskTag"
+
+	query := `
+		DELETE FROM task_tag USING tag, task
+			WHERE task_tag.tag_id = tag.id AND task_tag.task_id = task.id
+			AND tag.user_id = $1 AND ` + canAccessTask("$1", true) + `
+			AND task_tag.task_id = $2 AND task_tag.tag_id = $3;
+		`
+
+	stmt, err := user.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	result, err := stmt.Exec(user.ID, taskID, tagID)
+	if err != nil {
+		return fmt.Errorf("%s: failed to execute a query: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		task, err := user.GetTaskByID(taskID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", funcErrMsg, err)
+		}
+
+		if !task.CanEdit {
+			return fmt.Errorf("%s: %w", funcErrMsg, ErrPermissionDenied)
+		}
+
+		return fmt.Errorf("%s: %w", funcErrMsg, ErrTagNotFound)
+	}
+
+	return nil
+}
+
+// preparer is a *sql.DB or a *sql.Tx.
+type preparer interface {
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// addTaskTags tags a task the user can change, creating the tags they don't
+// have yet. Any other task is left alone.
+func (user *User) addTaskTags(db preparer, taskID int, names []string) error {
+	const funcErrMsg = "models.User.addTaskTags"
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	colors := make([]string, len(names))
+	for i, name := range names {
+		colors[i] = defaultTagColor(name)
+	}
+
+	const createQuery = `
+		INSERT INTO tag(user_id, name, color)
+			SELECT $1, new_tag.name, new_tag.color FROM unnest($2::TEXT[], $3::TEXT[]) AS new_tag(name, color)
+			ON CONFLICT (user_id, name) DO NOTHING;
+		`
+
+	stmt, err := db.Prepare(createQuery)
+	if err != nil {
+		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(user.ID, pq.Array(names), pq.Array(colors))
+	if err != nil {
+		return fmt.Errorf("%s: failed to create tags: %w", funcErrMsg, err)
+	}
+
+	linkQuery := `
+		INSERT INTO task_tag(task_id, tag_id)
+			SELECT task.id, tag.id FROM task
+				JOIN tag ON tag.user_id = $1
+				WHERE task.id = $2 AND tag.name = ANY($3) AND ` + canAccessTask("$1", true) + `
+			ON CONFLICT DO NOTHING;
+		`
+
+	stmt, err = db.Prepare(linkQuery)
+	if err != nil {
+		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(user.ID, taskID, pq.Array(names))
+	if err != nil {
+		return fmt.Errorf("%s: failed to tag a task: %w", funcErrMsg, err)
+	}
+
+	return nil
+}
+
+// loadTaskTags fills in the tags the user has put on the tasks.
+func (user *User) loadTaskTags(tasks Tasks) error {
+	const funcErrMsg = "models.User.loadTaskTags"
+
+	taskIndexes := make(map[int]int, len(tasks))
+	taskIDs := make([]int64, len(tasks))
+
+	for i := range tasks {
+		tasks[i].Tags = []Tag{}
+		taskIndexes[tasks[i].ID] = i
+		taskIDs[i] = int64(tasks[i].ID)
+	}
+
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	const query = `
+		SELECT task_tag.task_id, tag.id, tag.name, tag.color FROM task_tag
+			JOIN tag ON tag.id = task_tag.tag_id
+			WHERE tag.user_id = $1 AND task_tag.task_id = ANY($2)
+			ORDER BY tag.name;
+		`
+
+	stmt, err := user.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	rows, err := stmt.Query(user.ID, pq.Array(taskIDs))
+	if err != nil {
+		return fmt.Errorf("%s: failed to query tags: %w", funcErrMsg, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			taskID int
+			tag    Tag
+		)
+
+		err := rows.Scan(&taskID, &tag.ID, &tag.Name, &tag.Color)
+		if err != nil {
+			return fmt.Errorf("%s: failed to scan rows: %w", funcErrMsg, err)
+		}
+
+		index := taskIndexes[taskID]
+		tasks[index].Tags = append(tasks[index].Tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: rows error: %w", funcErrMsg, err)
+	}
+
+	return nil
+}
@@ -2,35 +2,272 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+const (
+	maxTaskTitleLength       = 200
+	maxTaskDescriptionLength = 10000
 )
 
 type Tasks []Task
 
 type Task struct {
-	ID     int
-	Title  string
-	IsDone bool
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	IsDone      bool       `json:"isDone"`
+	Description string     `json:"description"`
+	DueAt       *time.Time `json:"dueAt"`
+	IsOverdue   bool       `json:"isOverdue"`
+	IsDueToday  bool       `json:"isDueToday"`
+	Priority    Priority   `json:"priority"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	Tags        []Tag      `json:"tags"`
+	ListID      *int       `json:"listId"`
+	CanEdit     bool       `json:"canEdit"`
+	Subtasks    []Subtask  `json:"subtasks"`
+}
+
+// TaskDraft holds the fields of a task that is about to be created. A nil
+// ListID puts it into the Inbox.
+type TaskDraft struct {
+	Title       string
+	Description string
+	IsDone      bool
+	DueAt       *time.Time
+	Priority    Priority
+	Tags        []string
+	ListID      *int
+}
+
+// TaskUpdate holds the fields to change in a task; nil fields are kept.
+// RemoveDueAt clears the due date, which a nil DueAt can't express, and
+// AddTags are put on the task next to the tags it has, or instead of them
+// with ReplaceTags. ListID moves the task to another list and MoveToInbox
+// takes it out of its list.
+type TaskUpdate struct {
+	Title       *string
+	IsDone      *bool
+	Description *string
+	DueAt       *time.Time
+	RemoveDueAt bool
+	Priority    *Priority
+	AddTags     []string
+	ReplaceTags bool
+	ListID      *int
+	MoveToInbox bool
+}
+
+type TaskView string
+
+const (
+	TaskViewAll      TaskView = ""
+	TaskViewToday    TaskView = "today"
+	TaskViewUpcoming TaskView = "upcoming"
+	TaskViewNoDate   TaskView = "nodate"
+)
+
+const upcomingDays = 7
+
+func ParseTaskView(view string) (TaskView, error) {
+	switch taskView := TaskView(view); taskView {
+	case TaskViewAll, TaskViewToday, TaskViewUpcoming, TaskViewNoDate:
+		return taskView, nil
+	default:
+		return TaskViewAll, ErrUnknownTaskView
+	}
+}
+
+type TaskOrder string
+
+const (
+	// TaskOrderPriority puts the most urgent tasks first and the oldest
+	// first among tasks of the same priority.
+	TaskOrderPriority TaskOrder = ""
+	TaskOrderCreated  TaskOrder = "created"
+	TaskOrderDue      TaskOrder = "due"
+)
+
+func ParseTaskOrder(order string) (TaskOrder, error) {
+	switch taskOrder := TaskOrder(order); taskOrder {
+	case TaskOrderPriority, TaskOrderCreated, TaskOrderDue:
+		return taskOrder, nil
+	default:
+		return TaskOrderPriority, ErrUnknownTaskOrder
+	}
+}
+
+func (order TaskOrder) clause() string {
+	switch order {
+	case TaskOrderCreated:
+		return ` ORDER BY task.created_at, task.id`
+	case TaskOrderDue:
+		return ` ORDER BY task.due_at NULLS LAST, task.priority DESC, task.id`
+	default:
+		return ` ORDER BY task.priority DESC, task.created_at, task.id`
+	}
+}
+
+// TaskFilter narrows down the tasks GetTasks returns and sorts them. An empty
+// Tag matches every task. Inbox keeps the tasks that are in no list and ListID
+// the tasks of one list; with neither, the tasks of every list match.
+type TaskFilter struct {
+	View   TaskView
+	Order  TaskOrder
+	Tag    string
+	Inbox  bool
+	ListID int
+}
+
+// condition returns the WHERE clause of the filter and its arguments, numbered
+// after the user id. Days start at midnight in the time zone of the user.
+func (filter TaskFilter) condition(now time.Time, location *time.Location) (string, []any) {
+	now = now.In(location)
+	startOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	startOfTomorrow := startOfToday.AddDate(0, 0, 1)
+
+	var (
+		condition strings.Builder
+		args      []any
+	)
+
+	param := func(value any) string {
+		args = append(args, value)
+
+		return "$" + strconv.Itoa(len(args)+1)
+	}
+
+	switch filter.View {
+	case TaskViewToday:
+		// Today also shows whatever is overdue and still open.
+		condition.WriteString(` AND task.due_at < ` + param(startOfTomorrow) +
+			` AND (task.due_at >= ` + param(startOfToday) + ` OR NOT task.is_done)`)
+	case TaskViewUpcoming:
+		condition.WriteString(` AND task.due_at >= ` + param(startOfTomorrow) +
+			` AND task.due_at < ` + param(startOfTomorrow.AddDate(0, 0, upcomingDays)))
+	case TaskViewNoDate:
+		condition.WriteString(` AND task.due_at IS NULL`)
+	case TaskViewAll:
+	}
+
+	switch {
+	case filter.Inbox:
+		condition.WriteString(` AND task.list_id IS NULL`)
+	case filter.ListID != 0:
+		condition.WriteString(` AND task.list_id = ` + param(filter.ListID))
+	}
+
+	if filter.Tag != "" {
+		condition.WriteString(` AND EXISTS (
+			SELECT 1 FROM task_tag JOIN tag ON tag.id = task_tag.tag_id
+				WHERE task_tag.task_id = task.id AND tag.user_id = $1 AND tag.name = ` + param(strings.ToLower(filter.Tag)) + `)`)
+	}
+
+	return condition.String(), args
+}
+
+// taskColumns are the columns scanTask reads, for the user whose id is
+// userParam.
+func taskColumns(userParam string) string {
+	return `task.id, task.title, task.is_done, task.description, task.due_at,
+		task.priority, task.created_at, task.list_id, ` + canAccessTask(userParam, true)
+}
+
+// scanTask reads a row of taskColumns and works out whether the task is due in
+// the time zone of the user.
+func (user *User) scanTask(row rowScanner, now time.Time) (Task, error) {
+	task := Task{}
+
+	var (
+		dueAt  sql.NullTime
+		listID sql.NullInt64
+	)
+
+	err := row.Scan(
+		&task.ID,
+		&task.Title,
+		&task.IsDone,
+		&task.Description,
+		&dueAt,
+		&task.Priority,
+		&task.CreatedAt,
+		&listID,
+		&task.CanEdit,
+	)
+	if err != nil {
+		return Task{}, err
+	}
+
+	if listID.Valid {
+		id := int(listID.Int64)
+		task.ListID = &id
+	}
+
+	if dueAt.Valid {
+		user.setDueAt(&task, dueAt.Time, now)
+	}
+
+	return task, nil
 }
 
+func (user *User) setDueAt(task *Task, dueAt, now time.Time) {
+	location := user.Location()
+	dueAt = dueAt.In(location)
+	now = now.In(location)
+
+	task.DueAt = &dueAt
+	task.IsOverdue = !task.IsDone && dueAt.Before(now)
+	task.IsDueToday = dueAt.Year() == now.Year() && dueAt.YearDay() == now.YearDay()
+}
+
+// User is a signed in user. AutoCompleteTasks completes the tasks the user owns
+// once every item of their checklist is done, whoever checks the last one.
 type User struct {
-	ID       int
-	Login    string
-	Password string
-	db       *sql.DB
-	log      *slog.Logger
+	ID                int    `json:"id"`
+	Login             string `json:"login"`
+	Password          string `json:"-"`
+	TOTPEnabled       bool   `json:"totpEnabled"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"emailVerified"`
+	TimeZone          string `json:"timeZone"`
+	AutoCompleteTasks bool   `json:"autoCompleteTasks"`
+	db                *sql.DB
+	log               *slog.Logger
+	location          *time.Location
+}
+
+// Location returns the time zone of the user, UTC until they pick one.
+func (user User) Location() *time.Location {
+	if user.location == nil {
+		return time.UTC
+	}
+
+	return user.location
 }
 
-func (user *User) GetTasks() (Tasks, error) {
+// LogValue keeps the password hash out of the logs when a user is logged.
+func (user User) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int("id", user.ID), slog.String("login", user.Login))
+}
+
+func (user *User) GetTasks(filter TaskFilter) (Tasks, error) {
 	const funcErrMsg = "models.User.GetTasks"
 
-	const query = `
-		SELECT task.id, task.title, task.is_done FROM task
-			JOIN user_task ON task.id = user_task.task_id
-			JOIN "user" ON "user".id = user_task.user_id
-			WHERE "user".login = $1;
+	now := time.Now()
+	condition, args := filter.condition(now, user.Location())
+
+	query := `
+		SELECT ` + taskColumns("$1") + ` FROM task
+			WHERE ` + canAccessTask("$1", false) + condition + filter.Order.clause() + `;
 		`
 
 	stmt, err := user.db.Prepare(query)
@@ -40,7 +277,7 @@ func (user *User) GetTasks() (Tasks, error) {
 
 	defer stmt.Close()
 
-	rows, err := stmt.Query(user.Login)
+	rows, err := stmt.Query(append([]any{user.ID}, args...)...)
 	if err != nil {
 		return Tasks{}, fmt.Errorf("%s: failed to query tasks table: %w", funcErrMsg, err)
 	}
@@ -50,9 +287,7 @@ func (user *User) GetTasks() (Tasks, error) {
 	tasks := Tasks{}
 
 	for rows.Next() {
-		task := Task{}
-
-		err := rows.Scan(&task.ID, &task.Title, &task.IsDone)
+		task, err := user.scanTask(rows, now)
 		if err != nil {
 			return Tasks{}, fmt.Errorf("%s: failed to scan rows: %w", funcErrMsg, err)
 		}
@@ -64,20 +299,54 @@ func (user *User) GetTasks() (Tasks, error) {
 		return Tasks{}, fmt.Errorf("%s: rows error: %w", funcErrMsg, err)
 	}
 
+	err = user.loadTaskDetails(tasks)
+	if err != nil {
+		return Tasks{}, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
 	return tasks, nil
 }
 
-func (user *User) NewTask(title string, isDone bool) (Task, error) {
+func (user *User) NewTask(draft TaskDraft) (Task, error) {
 	const funcErrMsg = "models.User.NewTask"
 
-	stmt, err := user.db.Prepare("INSERT INTO task(title, is_done) VALUES ($1, $2) RETURNING id")
+	title, err := validateTaskTitle(draft.Title)
+	if err != nil {
+		return Task{}, err
+	}
+
+	description, err := validateTaskDescription(draft.Description)
+	if err != nil {
+		return Task{}, err
+	}
+
+	if !draft.Priority.isValid() {
+		return Task{}, ErrInvalidPriority
+	}
+
+	draft.Tags, err = normalizeTagNames(draft.Tags)
+	if err != nil {
+		return Task{}, err
+	}
+
+	if draft.ListID != nil {
+		err = user.checkListOpen(*draft.ListID)
+		if err != nil {
+			return Task{}, err
+		}
+	}
+
+	stmt, err := user.db.Prepare(`
+		INSERT INTO task(title, description, is_done, due_at, priority, list_id) VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at
+		`)
 	if err != nil {
 		return Task{}, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
 	}
 
 	defer stmt.Close()
 
-	rows, err := stmt.Query(title, isDone)
+	rows, err := stmt.Query(title, description, draft.IsDone, draft.DueAt, draft.Priority, draft.ListID)
 	if err != nil {
 		return Task{}, fmt.Errorf("%s: failed to execute a statement: %w", funcErrMsg, err)
 	}
@@ -94,9 +363,12 @@ func (user *User) NewTask(title string, isDone bool) (Task, error) {
 		return Task{}, fmt.Errorf("%s: rows.Err(): %w", funcErrMsg, err)
 	}
 
-	var taskID int
+	var (
+		taskID    int
+		createdAt time.Time
+	)
 
-	err = rows.Scan(&taskID)
+	err = rows.Scan(&taskID, &createdAt)
 	if err != nil {
 		return Task{}, fmt.Errorf("%s: failed to scan a task id : %w", funcErrMsg, err)
 	}
@@ -115,6 +387,11 @@ func (user *User) NewTask(title string, isDone bool) (Task, error) {
 		return Task{}, fmt.Errorf("%s: failed to execute a statement: %w", funcErrMsg, err)
 	}
 
+	err = user.addTaskTags(user.db, taskID, draft.Tags)
+	if err != nil {
+		return Task{}, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
 	user.log.Info(
 		"Succsesfully inserted:",
 		"id",
@@ -122,88 +399,121 @@ func (user *User) NewTask(title string, isDone bool) (Task, error) {
 		"title",
 		title,
 		"isDone",
-		isDone,
+		draft.IsDone,
 	)
 
-	task := Task{taskID, title, isDone}
+	task := Task{
+		ID:          taskID,
+		Title:       title,
+		IsDone:      draft.IsDone,
+		Description: description,
+		Priority:    draft.Priority,
+		CreatedAt:   createdAt,
+		ListID:      draft.ListID,
+		CanEdit:     true,
+	}
+	if draft.DueAt != nil {
+		user.setDueAt(&task, *draft.DueAt, time.Now())
+	}
+
+	return user.withDetails(task)
+}
 
-	return task, nil
+func (user *User) withDetails(task Task) (Task, error) {
+	tasks := Tasks{task}
+
+	err := user.loadTaskDetails(tasks)
+	if err != nil {
+		return Task{}, err
+	}
+
+	return tasks[0], nil
+}
+
+// loadTaskDetails fills in the tags and the checklists of the tasks.
+func (user *User) loadTaskDetails(tasks Tasks) error {
+	err := user.loadTaskTags(tasks)
+	if err != nil {
+		return err
+	}
+
+	return user.loadSubtasks(tasks)
 }
 
 func (user *User) RemoveTask(taskID int) error {
 	const funcErrMsg = "models.User.RemoveTask"
 
-	stmt, err := user.db.Prepare("DELETE FROM task WHERE id = $1")
+	query := `DELETE FROM task WHERE task.id = $1 AND ` + canAccessTask("$2", true)
+
+	stmt, err := user.db.Prepare(query)
 	if err != nil {
 		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
 	}
 
 	defer stmt.Close()
 
-	_, err = stmt.Exec(taskID)
+	result, err := stmt.Exec(taskID, user.ID)
 	if err != nil {
 		return fmt.Errorf("%s: failed to execute a query: %w", funcErrMsg, err)
 	}
 
-	return nil
-}
-
-func (user *User) GetTaskByID(taskID int) (Task, error) {
-	const funcErrMsg = "models.User.GetTask"
-
-	stmt, err := user.db.Prepare("SELECT * FROM task WHERE id = $1")
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return Task{}, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
+		return fmt.Errorf("%s: failed to get rows affected: %w", funcErrMsg, err)
 	}
 
-	task, err := user.GetTask(stmt, strconv.Itoa(taskID))
-	if err != nil {
-		return Task{}, fmt.Errorf("%s: failed to get a task: %w", funcErrMsg, err)
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", funcErrMsg, user.missingTaskError(taskID))
 	}
 
-	return task, nil
+	return nil
 }
 
-func (user *User) GetTask(stmt *sql.Stmt, title string) (Task, error) {
-	const funcErrMsg = "models.User.GetTask"
+func (user *User) GetTaskByID(taskID int) (Task, error) {
+	const funcErrMsg = "models.User.GetTaskByID"
+
+	query := `
+		SELECT ` + taskColumns("$2") + ` FROM task
+			WHERE task.id = $1 AND ` + canAccessTask("$2", false) + `;
+		`
 
-	result, err := stmt.Query(title)
+	stmt, err := user.db.Prepare(query)
 	if err != nil {
-		return Task{}, fmt.Errorf("%s: failed to execute a query: %w", funcErrMsg, err)
+		return Task{}, fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
 	}
 
-	defer result.Close()
+	defer stmt.Close()
 
-	hasNext := result.Next()
-	if !hasNext {
-		return Task{}, fmt.Errorf("%s: task is not found", funcErrMsg)
+	task, err := user.scanTask(stmt.QueryRow(taskID, user.ID), time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return Task{}, fmt.Errorf("%s: %w", funcErrMsg, ErrTaskNotFound)
 	}
 
-	if err = result.Err(); err != nil {
-		return Task{}, fmt.Errorf("%s: task is not found: %w", funcErrMsg, err)
+	if err != nil {
+		return Task{}, fmt.Errorf("%s: failed to scan a query response: %w", funcErrMsg, err)
 	}
 
-	task := Task{}
-
-	err = result.Scan(&task.ID, &task.Title, &task.IsDone)
+	task, err = user.withDetails(task)
 	if err != nil {
-		return Task{}, fmt.Errorf("%s: failed to scan a query response: %w", funcErrMsg, err)
+		return Task{}, fmt.Errorf("%s: %w", funcErrMsg, err)
 	}
 
 	return task, nil
 }
 
 func (user *User) SetDoneStatus(taskID int, isDone bool) error {
-	const funcErrMsg = "models.User.ToggleDoneStatus"
+	const funcErrMsg = "models.User.SetDoneStatus"
+
+	query := `UPDATE task SET is_done = $1 WHERE task.id = $2 AND ` + canAccessTask("$3", true)
 
-	stmt, err := user.db.Prepare("UPDATE task SET is_done = $1 WHERE id = $2")
+	stmt, err := user.db.Prepare(query)
 	if err != nil {
 		return fmt.Errorf("%s: failed to prepare a statement: %w", funcErrMsg, err)
 	}
 
 	defer stmt.Close()
 
-	result, err := stmt.Exec(isDone, taskID)
+	result, err := stmt.Exec(isDone, taskID, user.ID)
 	if err != nil {
 		return fmt.Errorf("%s: failed to execute a query: %w", funcErrMsg, err)
 	}
@@ -214,8 +524,158 @@ func (user *User) SetDoneStatus(taskID int, isDone bool) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("%s: no rows affected", funcErrMsg)
+		return fmt.Errorf("%s: %w", funcErrMsg, user.missingTaskError(taskID))
 	}
 
 	return nil
 }
+
+func (user *User) UpdateTask(taskID int, update TaskUpdate) (Task, error) {
+	const funcErrMsg = "models.User.UpdateTask"
+
+	if update.Title != nil {
+		title, err := validateTaskTitle(*update.Title)
+		if err != nil {
+			return Task{}, err
+		}
+
+		update.Title = &title
+	}
+
+	if update.Description != nil {
+		description, err := validateTaskDescription(*update.Description)
+		if err != nil {
+			return Task{}, err
+		}
+
+		update.Description = &description
+	}
+
+	if update.Priority != nil && !update.Priority.isValid() {
+		return Task{}, ErrInvalidPriority
+	}
+
+	addTags, err := normalizeTagNames(update.AddTags)
+	if err != nil {
+		return Task{}, err
+	}
+
+	if update.ListID != nil {
+		err = user.checkListOpen(*update.ListID)
+		if err != nil {
+			return Task{}, err
+		}
+	}
+
+	tx, err := user.db.Begin()
+	if err != nil {
+		return Task{}, fmt.Errorf("%s: failed to begin a transaction: %w", funcErrMsg, err)
+	}
+
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	// A task moved to the Inbox goes to the Inbox of the user who moves it.
+	if update.MoveToInbox {
+		_, err = tx.Exec(`
+			UPDATE user_task SET user_id = $1 FROM task
+				WHERE user_task.task_id = task.id AND task.id = $2 AND `+canAccessTask("$1", true),
+			user.ID,
+			taskID,
+		)
+		if err != nil {
+			return Task{}, fmt.Errorf("%s: failed to move a task to the Inbox: %w", funcErrMsg, err)
+		}
+	}
+
+	query := `
+		UPDATE task SET title = COALESCE($1::TEXT, title), is_done = COALESCE($2::BOOLEAN, is_done),
+			description = COALESCE($3::TEXT, description),
+			due_at = CASE WHEN $4::BOOLEAN THEN NULL ELSE COALESCE($5::TIMESTAMPTZ, due_at) END,
+			priority = COALESCE($6::SMALLINT, priority),
+			list_id = CASE WHEN $9::BOOLEAN THEN NULL ELSE COALESCE($10::INT, list_id) END
+			WHERE task.id = $7 AND ` + canAccessTask("$8", true) + `
+			RETURNING ` + taskColumns("$8") + `;
+		`
+
+	row := tx.QueryRow(
+		query,
+		update.Title,
+		update.IsDone,
+		update.Description,
+		update.RemoveDueAt,
+		update.DueAt,
+		update.Priority,
+		taskID,
+		user.ID,
+		update.MoveToInbox,
+		update.ListID,
+	)
+
+	task, err := user.scanTask(row, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return Task{}, fmt.Errorf("%s: %w", funcErrMsg, user.missingTaskError(taskID))
+	}
+
+	if err != nil {
+		return Task{}, fmt.Errorf("%s: failed to scan a query response: %w", funcErrMsg, err)
+	}
+
+	// The update above checked that the user can change the task.
+	if update.ReplaceTags {
+		_, err = tx.Exec(`
+			DELETE FROM task_tag USING tag
+				WHERE task_tag.tag_id = tag.id AND task_tag.task_id = $1 AND tag.user_id = $2
+				AND NOT tag.name = ANY($3)
+			`,
+			taskID,
+			user.ID,
+			pq.Array(addTags),
+		)
+		if err != nil {
+			return Task{}, fmt.Errorf("%s: failed to untag a task: %w", funcErrMsg, err)
+		}
+	}
+
+	err = user.addTaskTags(tx, taskID, addTags)
+	if err != nil {
+		return Task{}, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Task{}, fmt.Errorf("%s: failed to commit a transaction: %w", funcErrMsg, err)
+	}
+
+	task, err = user.withDetails(task)
+	if err != nil {
+		return Task{}, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	return task, nil
+}
+
+func validateTaskTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+
+	if title == "" {
+		return "", ErrEmptyTaskTitle
+	}
+
+	if utf8.RuneCountInString(title) > maxTaskTitleLength {
+		return "", ErrTaskTitleTooLong
+	}
+
+	return title, nil
+}
+
+// validateTaskDescription trims the trailing whitespace an editor leaves behind
+// but keeps the leading indentation, which is meaningful in Markdown.
+func validateTaskDescription(description string) (string, error) {
+	description = strings.TrimRightFunc(description, unicode.IsSpace)
+
+	if utf8.RuneCountInString(description) > maxTaskDescriptionLength {
+		return "", ErrTaskDescriptionTooLong
+	}
+
+	return description, nil
+}
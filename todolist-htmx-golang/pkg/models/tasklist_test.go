@@ -0,0 +1,88 @@
+package models
+
+import (
+	"io"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newMockUser returns a user whose queries go to a sqlmock database, which
+// checks that every expectation was met at the end of the test.
+func newMockUser(t *testing.T, userID int) (User, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+
+		db.Close()
+	})
+
+	return User{ID: userID, db: db, log: slog.New(slog.NewTextHandler(io.Discard, nil))}, mock
+}
+
+var taskRowColumns = []string{
+	"id", "title", "is_done", "description", "due_at", "priority", "created_at", "list_id", "can_edit",
+}
+
+func TestUpdateTaskTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		replaceTags bool
+	}{
+		{"adding tags keeps the other ones", false},
+		{"replacing tags removes the other ones", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, mock := newMockUser(t, 1)
+			title := "Deploy"
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("UPDATE task SET")).
+				WillReturnRows(sqlmock.NewRows(taskRowColumns).
+					AddRow(7, title, false, "", nil, 0, time.Now(), nil, true))
+
+			if test.replaceTags {
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM task_tag")).
+					WithArgs(7, 1, `{"work"}`).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+			}
+
+			mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO tag")).
+				ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO task_tag")).
+				ExpectExec().WithArgs(1, 7, `{"work"}`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			mock.ExpectPrepare(regexp.QuoteMeta("SELECT task_tag.task_id")).
+				ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"task_id", "id", "name", "color"}).
+				AddRow(7, 3, "work", "blue"))
+			mock.ExpectPrepare(regexp.QuoteMeta("SELECT task_id, id, title, is_done FROM subtask")).
+				ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"task_id", "id", "title", "is_done"}))
+
+			task, err := user.UpdateTask(7, TaskUpdate{
+				Title:       &title,
+				AddTags:     []string{"#Work"},
+				ReplaceTags: test.replaceTags,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(task.Tags) != 1 || task.Tags[0].Name != "work" {
+				t.Errorf("tags = %+v, want only work", task.Tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const tokenBytes = 32
+
+// NewToken returns a URL-safe random token suitable for cookies and links.
+func NewToken() (string, error) {
+	const funcErrMsg = "models.NewToken"
+
+	buf := make([]byte, tokenBytes)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to read random bytes: %w", funcErrMsg, err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the value under which a token is stored, so a leaked
+// storage dump can't be replayed as a cookie or a link.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
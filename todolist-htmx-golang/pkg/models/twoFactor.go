@@ -0,0 +1,329 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled    = errors.New("two-factor authentication setup is not started")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTOTPCode    = errors.New("invalid code")
+)
+
+const (
+	recoveryCodesCount = 10
+	recoveryCodeBytes  = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// BeginTOTPEnrollment stores a fresh secret for the user. It only takes effect
+// once EnableTOTP confirms that the authenticator app produces valid codes.
+func (storage *UserStorage) BeginTOTPEnrollment(userID int) (string, error) {
+	const funcErrMsg = "storage.UserStorage.BeginTOTPEnrollment"
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	const query = `UPDATE "user" SET totp_secret = $1 WHERE id = $2 AND NOT totp_enabled`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return "", fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	result, err := stmt.Exec(secret, userID)
+	if err != nil {
+		return "", fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("%s failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		return "", ErrTOTPAlreadyEnabled
+	}
+
+	return secret, nil
+}
+
+// EnableTOTP turns two-factor authentication on if the code matches the
+// enrolled secret and returns new single-use recovery codes.
+func (storage *UserStorage) EnableTOTP(userID int, code string) ([]string, error) {
+	const funcErrMsg = "storage.UserStorage.EnableTOTP"
+
+	secret, isEnabled, _, err := storage.getTOTP(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	if isEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	if secret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	step, isValid := ValidateTOTP(secret, normalizeCode(code), time.Now())
+	if !isValid {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	tx, err := storage.database.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to begin a transaction: %w", funcErrMsg, err)
+	}
+
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	_, err = tx.Exec(
+		`UPDATE "user" SET totp_enabled = TRUE, totp_last_step = $1 WHERE id = $2`,
+		step,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to enable totp: %w", funcErrMsg, err)
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to commit a transaction: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("enabled two-factor authentication", "id", userID)
+
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off after checking a code.
+func (storage *UserStorage) DisableTOTP(userID int, code string) error {
+	const funcErrMsg = "storage.UserStorage.DisableTOTP"
+
+	err := storage.VerifySecondFactor(userID, code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	tx, err := storage.database.Begin()
+	if err != nil {
+		return fmt.Errorf("%s failed to begin a transaction: %w", funcErrMsg, err)
+	}
+
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	_, err = tx.Exec(
+		`UPDATE "user" SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = 0 WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s failed to disable totp: %w", funcErrMsg, err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_code WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("%s failed to delete recovery codes: %w", funcErrMsg, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("%s failed to commit a transaction: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("disabled two-factor authentication", "id", userID)
+
+	return nil
+}
+
+// VerifySecondFactor accepts either a current TOTP code, which can't be reused,
+// or one of the unused recovery codes, which is spent.
+func (storage *UserStorage) VerifySecondFactor(userID int, code string) error {
+	const funcErrMsg = "storage.UserStorage.VerifySecondFactor"
+
+	secret, isEnabled, lastStep, err := storage.getTOTP(userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	if !isEnabled {
+		return ErrTOTPNotEnabled
+	}
+
+	code = normalizeCode(code)
+
+	step, isValid := ValidateTOTP(secret, code, time.Now())
+	if isValid {
+		if step <= lastStep {
+			return ErrInvalidTOTPCode
+		}
+
+		return storage.useTOTPStep(userID, step)
+	}
+
+	return storage.useRecoveryCode(userID, code)
+}
+
+func (storage *UserStorage) getTOTP(userID int) (string, bool, int64, error) {
+	const funcErrMsg = "storage.UserStorage.getTOTP"
+
+	const query = `SELECT totp_secret, totp_enabled, totp_last_step FROM "user" WHERE id = $1`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return "", false, 0, fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	var (
+		secret    sql.NullString
+		isEnabled bool
+		lastStep  int64
+	)
+
+	err = stmt.QueryRow(userID).Scan(&secret, &isEnabled, &lastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, 0, ErrUserNotFound
+	}
+
+	if err != nil {
+		return "", false, 0, fmt.Errorf("%s failed to scan a user: %w", funcErrMsg, err)
+	}
+
+	return secret.String, isEnabled, lastStep, nil
+}
+
+func (storage *UserStorage) useTOTPStep(userID int, step int64) error {
+	const funcErrMsg = "storage.UserStorage.useTOTPStep"
+
+	const query = `UPDATE "user" SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	result, err := stmt.Exec(step, userID)
+	if err != nil {
+		return fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidTOTPCode
+	}
+
+	return nil
+}
+
+func (storage *UserStorage) useRecoveryCode(userID int, code string) error {
+	const funcErrMsg = "storage.UserStorage.useRecoveryCode"
+
+	const query = `
+		UPDATE recovery_code SET used_at = now()
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+		`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	result, err := stmt.Exec(userID, HashToken(code))
+	if err != nil {
+		return fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s failed to get rows affected: %w", funcErrMsg, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidTOTPCode
+	}
+
+	storage.log.Info("used a recovery code", "id", userID)
+
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	const funcErrMsg = "models.replaceRecoveryCodes"
+
+	_, err := tx.Exec(`DELETE FROM recovery_code WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to delete recovery codes: %w", funcErrMsg, err)
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO recovery_code(user_id, code_hash) VALUES ($1, $2)`)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	codes := make([]string, 0, recoveryCodesCount)
+
+	for range recoveryCodesCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", funcErrMsg, err)
+		}
+
+		_, err = stmt.Exec(userID, HashToken(normalizeCode(code)))
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to insert a recovery code: %w", funcErrMsg, err)
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, recoveryCodeBytes)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf))
+
+	return code[:len(code)/2] + "-" + code[len(code)/2:], nil
+}
+
+// normalizeCode lets users type codes with spaces, dashes or in upper case.
+func normalizeCode(code string) string {
+	code = strings.ToLower(code)
+
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
@@ -5,29 +5,43 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 )
 
 var (
 	ErrUserAlreadyExist = errors.New("user already exist")
 	ErrUserNotFound     = errors.New("user not found")
 	ErrBadPassword      = errors.New("bad password")
+	ErrEmptyPassword    = errors.New("password can't be empty")
+	ErrInvalidEmail     = errors.New("invalid email address")
+	ErrEmailAlreadyUsed = errors.New("email address is already used")
+	ErrInvalidTimeZone  = errors.New("unknown time zone")
 )
 
+const userColumns = `id, login, password, totp_enabled, COALESCE(email, ''), email_verified, time_zone,
+	auto_complete_tasks`
+
 type UserStorage struct {
 	log      *slog.Logger
 	database *sql.DB
+	hasher   PasswordHasher
 }
 
-func GetUserStorage(log *slog.Logger, database *sql.DB) UserStorage {
-	return UserStorage{log, database}
+func GetUserStorage(log *slog.Logger, database *sql.DB, hasher PasswordHasher) UserStorage {
+	return UserStorage{log, database, hasher}
 }
 
-func (storage *UserStorage) Register(login, password string) error {
+func (storage *UserStorage) Register(login, password, email string) (User, error) {
 	const funcErrMsg = "storage.UserStorage.Register"
 
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return User{}, err
+	}
+
 	isLoginTaken, err := storage.loginIsTaken(login)
 	if err != nil {
-		return fmt.Errorf(
+		return User{}, fmt.Errorf(
 			"%s failed to check is login is taken: %w",
 			funcErrMsg,
 			ErrUserAlreadyExist,
@@ -35,36 +49,98 @@ func (storage *UserStorage) Register(login, password string) error {
 	}
 
 	if isLoginTaken {
-		return fmt.Errorf("%w", ErrUserAlreadyExist)
+		return User{}, fmt.Errorf("%w", ErrUserAlreadyExist)
+	}
+
+	isEmailTaken, err := storage.emailIsTaken(email)
+	if err != nil {
+		return User{}, fmt.Errorf("%s failed to check is email is taken: %w", funcErrMsg, err)
+	}
+
+	if isEmailTaken {
+		return User{}, ErrEmailAlreadyUsed
 	}
 
-	err = storage.addUser(login, password)
+	passwordHash, err := storage.hasher.Hash(password)
 	if err != nil {
-		return fmt.Errorf("%s failed to add a user: %w", funcErrMsg, err)
+		return User{}, fmt.Errorf("%s failed to hash a password: %w", funcErrMsg, err)
+	}
+
+	err = storage.addUser(login, passwordHash, email)
+	if err != nil {
+		return User{}, fmt.Errorf("%s failed to add a user: %w", funcErrMsg, err)
 	}
 
 	storage.log.Info("registered a new user", "login", login)
 
-	return nil
+	user, err := storage.GetUserWithLogin(login)
+	if err != nil {
+		return User{}, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	return user, nil
 }
 
-func (storage *UserStorage) Login(login, password string) error {
+func (storage *UserStorage) Login(login, password string) (User, error) {
 	const funcErrMsg = "storage.UserStorage.Login"
 
 	storedUser, err := storage.GetUserWithLogin(login)
 	if errors.Is(err, ErrUserNotFound) {
-		return ErrUserNotFound
+		return User{}, ErrUserNotFound
+	}
+
+	if err != nil {
+		return User{}, fmt.Errorf("%s failed to login: %w", funcErrMsg, err)
+	}
+
+	isMatched, err := storage.hasher.Verify(storedUser.Password, password)
+	if err != nil {
+		return User{}, fmt.Errorf("%s failed to verify a password: %w", funcErrMsg, err)
+	}
+
+	if !isMatched {
+		return User{}, ErrBadPassword
+	}
+
+	if storage.hasher.NeedsRehash(storedUser.Password) {
+		err = storage.rehashPassword(storedUser.ID, storedUser.Password, password)
+		if err != nil {
+			storage.log.Error("failed to upgrade a password hash", "login", login, "err", err)
+		}
+	}
+
+	storage.log.Info("succsessfully logged!", "login", login)
+
+	return storedUser, nil
+}
+
+func (storage *UserStorage) ChangePassword(userID int, oldPassword, newPassword string) error {
+	const funcErrMsg = "storage.UserStorage.ChangePassword"
+
+	if newPassword == "" {
+		return ErrEmptyPassword
 	}
 
+	storedUser, err := storage.GetUserWithID(userID)
 	if err != nil {
-		return fmt.Errorf("%s failed to login: %w", funcErrMsg, err)
+		return fmt.Errorf("%s failed to get a user: %w", funcErrMsg, err)
 	}
 
-	if storedUser.Password != password {
+	isMatched, err := storage.hasher.Verify(storedUser.Password, oldPassword)
+	if err != nil {
+		return fmt.Errorf("%s failed to verify a password: %w", funcErrMsg, err)
+	}
+
+	if !isMatched {
 		return ErrBadPassword
 	}
 
-	storage.log.Info("succsessfully logged!", "login", login, "password", password)
+	err = storage.setPassword(userID, newPassword)
+	if err != nil {
+		return fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("changed a password", "id", userID)
 
 	return nil
 }
@@ -72,7 +148,31 @@ func (storage *UserStorage) Login(login, password string) error {
 func (storage *UserStorage) GetUserWithLogin(login string) (User, error) {
 	const funcErrMsg = "storage.UserStorage.GetUserWithLogin"
 
-	const query = `SELECT id, login, password FROM "user" WHERE login = $1`
+	const query = `SELECT ` + userColumns + ` FROM "user" WHERE login = $1`
+
+	user, err := storage.getUser(query, login)
+	if err != nil {
+		return User{}, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	return user, nil
+}
+
+func (storage *UserStorage) GetUserWithID(userID int) (User, error) {
+	const funcErrMsg = "storage.UserStorage.GetUserWithID"
+
+	const query = `SELECT ` + userColumns + ` FROM "user" WHERE id = $1`
+
+	user, err := storage.getUser(query, userID)
+	if err != nil {
+		return User{}, fmt.Errorf("%s: %w", funcErrMsg, err)
+	}
+
+	return user, nil
+}
+
+func (storage *UserStorage) getUser(query string, arg any) (User, error) {
+	const funcErrMsg = "storage.UserStorage.getUser"
 
 	stmt, err := storage.database.Prepare(query)
 	if err != nil {
@@ -81,7 +181,7 @@ func (storage *UserStorage) GetUserWithLogin(login string) (User, error) {
 
 	defer stmt.Close()
 
-	rows, err := stmt.Query(login)
+	rows, err := stmt.Query(arg)
 	if err != nil {
 		return User{}, fmt.Errorf("%s failed to query a statement: %w", funcErrMsg, err)
 	}
@@ -100,18 +200,135 @@ func (storage *UserStorage) GetUserWithLogin(login string) (User, error) {
 
 	user := User{db: storage.database, log: storage.log}
 
-	err = rows.Scan(&user.ID, &user.Login, &user.Password)
+	err = rows.Scan(
+		&user.ID,
+		&user.Login,
+		&user.Password,
+		&user.TOTPEnabled,
+		&user.Email,
+		&user.EmailVerified,
+		&user.TimeZone,
+		&user.AutoCompleteTasks,
+	)
 	if err != nil {
 		return User{}, fmt.Errorf("%s failed to scan a user: %w", funcErrMsg, err)
 	}
 
+	user.location, err = time.LoadLocation(user.TimeZone)
+	if err != nil {
+		storage.log.Warn("unknown time zone, using UTC", "id", user.ID, "timeZone", user.TimeZone)
+
+		user.location = time.UTC
+	}
+
 	return user, nil
 }
 
-func (storage *UserStorage) addUser(login, password string) error {
+// SetTimeZone stores the IANA time zone, like "Europe/Berlin", that due dates
+// of the user are shown and entered in.
+func (storage *UserStorage) SetTimeZone(userID int, timeZone string) error {
+	const funcErrMsg = "storage.UserStorage.SetTimeZone"
+
+	_, err := time.LoadLocation(timeZone)
+	if timeZone == "" || timeZone == "Local" || err != nil {
+		return ErrInvalidTimeZone
+	}
+
+	stmt, err := storage.database.Prepare(`UPDATE "user" SET time_zone = $1 WHERE id = $2`)
+	if err != nil {
+		return fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(timeZone, userID)
+	if err != nil {
+		return fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("changed a time zone", "id", userID, "timeZone", timeZone)
+
+	return nil
+}
+
+// SetAutoCompleteTasks turns on or off completing the tasks of the user, in
+// their Inbox and lists, once every item of their checklist is done.
+func (storage *UserStorage) SetAutoCompleteTasks(userID int, autoComplete bool) error {
+	const funcErrMsg = "storage.UserStorage.SetAutoCompleteTasks"
+
+	stmt, err := storage.database.Prepare(`UPDATE "user" SET auto_complete_tasks = $1 WHERE id = $2`)
+	if err != nil {
+		return fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(autoComplete, userID)
+	if err != nil {
+		return fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("changed task auto-completion", "id", userID, "autoComplete", autoComplete)
+
+	return nil
+}
+
+func (storage *UserStorage) addUser(login, password, email string) error {
 	const funcErrMsg = "storage.UserStorage.addUser"
 
-	const query = `INSERT INTO "user"(login, password) VALUES ($1, $2);`
+	const query = `INSERT INTO "user"(login, password, email) VALUES ($1, $2, $3);`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(login, password, email)
+	if err != nil {
+		return fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	return nil
+}
+
+func (storage *UserStorage) rehashPassword(userID int, oldStored, password string) error {
+	const funcErrMsg = "storage.UserStorage.rehashPassword"
+
+	passwordHash, err := storage.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("%s failed to hash a password: %w", funcErrMsg, err)
+	}
+
+	const query = `UPDATE "user" SET password = $1 WHERE id = $2 AND password = $3`
+
+	stmt, err := storage.database.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s failed to prepare a statement: %w", funcErrMsg, err)
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.Exec(passwordHash, userID, oldStored)
+	if err != nil {
+		return fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
+	}
+
+	storage.log.Info("upgraded a password hash", "id", userID)
+
+	return nil
+}
+
+func (storage *UserStorage) setPassword(userID int, password string) error {
+	const funcErrMsg = "storage.UserStorage.setPassword"
+
+	passwordHash, err := storage.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("%s failed to hash a password: %w", funcErrMsg, err)
+	}
+
+	const query = `UPDATE "user" SET password = $1 WHERE id = $2`
 
 	stmt, err := storage.database.Prepare(query)
 	if err != nil {
@@ -120,7 +337,7 @@ func (storage *UserStorage) addUser(login, password string) error {
 
 	defer stmt.Close()
 
-	_, err = stmt.Exec(login, password)
+	_, err = stmt.Exec(passwordHash, userID)
 	if err != nil {
 		return fmt.Errorf("%s failed to execute a statement: %w", funcErrMsg, err)
 	}
@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/deeprecession/golang-htmx-crud/pkg/models"
+)
+
+var (
+	ErrMissingIDToken = errors.New("token response has no id_token")
+	ErrNonceMismatch  = errors.New("id_token nonce does not match")
+)
+
+type ProviderConfig struct {
+	Name         string
+	DisplayName  string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Provider logs users in with the authorization code flow and PKCE against an
+// OpenID Connect identity provider.
+type Provider struct {
+	name         string
+	displayName  string
+	oauth2Config oauth2.Config
+	verifier     *gooidc.IDTokenVerifier
+}
+
+// NewProvider reads the issuer's discovery document, so the provider has to be
+// reachable at startup.
+func NewProvider(ctx context.Context, config ProviderConfig) (*Provider, error) {
+	const funcErrMsg = "oidc.NewProvider"
+
+	provider, err := gooidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to discover %q: %w", funcErrMsg, config.IssuerURL, err)
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+
+	displayName := config.DisplayName
+	if displayName == "" {
+		displayName = config.Name
+	}
+
+	return &Provider{
+		name:        config.Name,
+		displayName: displayName,
+		oauth2Config: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{gooidc.ScopeOpenID}, scopes...),
+		},
+		verifier: provider.Verifier(&gooidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+func (provider *Provider) Name() string {
+	return provider.name
+}
+
+func (provider *Provider) DisplayName() string {
+	return provider.displayName
+}
+
+// AuthCodeURL returns where to send the browser to log in. The code verifier
+// stays on our side and is only sent with the code exchange.
+func (provider *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	return provider.oauth2Config.AuthCodeURL(
+		state,
+		gooidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(codeVerifier),
+	)
+}
+
+// Exchange trades the authorization code for tokens and returns the identity
+// from the verified id_token.
+func (provider *Provider) Exchange(
+	ctx context.Context,
+	code string,
+	codeVerifier string,
+	nonce string,
+) (models.ExternalIdentity, error) {
+	const funcErrMsg = "oidc.Provider.Exchange"
+
+	token, err := provider.oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return models.ExternalIdentity{}, fmt.Errorf("%s failed to exchange a code: %w", funcErrMsg, err)
+	}
+
+	rawIDToken, isString := token.Extra("id_token").(string)
+	if !isString || rawIDToken == "" {
+		return models.ExternalIdentity{}, fmt.Errorf("%s: %w", funcErrMsg, ErrMissingIDToken)
+	}
+
+	idToken, err := provider.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return models.ExternalIdentity{}, fmt.Errorf("%s failed to verify id_token: %w", funcErrMsg, err)
+	}
+
+	if idToken.Nonce != nonce {
+		return models.ExternalIdentity{}, fmt.Errorf("%s: %w", funcErrMsg, ErrNonceMismatch)
+	}
+
+	claims := struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+	}{}
+
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return models.ExternalIdentity{}, fmt.Errorf("%s failed to decode claims: %w", funcErrMsg, err)
+	}
+
+	return models.ExternalIdentity{
+		Provider:          provider.name,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
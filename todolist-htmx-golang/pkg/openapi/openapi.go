@@ -0,0 +1,319 @@
+package openapi
+
+import (
+	"encoding"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	schemaNames map[reflect.Type]string
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower case HTTP methods to their operations.
+type PathItem map[string]Operation
+
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Schema is the subset of JSON Schema 2020-12 that the document needs.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+func NewDocument(info Info) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{},
+		},
+		schemaNames: map[reflect.Type]string{},
+	}
+}
+
+// Add describes a route. The path uses echo's syntax, so routes can be copied
+// from getServer as they are.
+func (document *Document) Add(method, path string, operation Operation) {
+	path = openAPIPath(path)
+
+	for _, name := range pathParams(path) {
+		operation.Parameters = append(operation.Parameters, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+
+	if document.Paths[path] == nil {
+		document.Paths[path] = PathItem{}
+	}
+
+	document.Paths[path][strings.ToLower(method)] = operation
+}
+
+// SchemaRef adds a component schema reflected from the type of the value and
+// returns a reference to it. Later schemas refer to it instead of repeating it.
+func (document *Document) SchemaRef(name string, value any) *Schema {
+	valueType := reflect.TypeOf(value)
+
+	document.Components.Schemas[name] = document.schemaFor(valueType)
+	document.schemaNames[valueType] = name
+
+	return schemaRef(name)
+}
+
+func schemaRef(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (document *Document) schemaFor(valueType reflect.Type) *Schema {
+	if name, isKnown := document.schemaNames[valueType]; isKnown {
+		return schemaRef(name)
+	}
+
+	// encoding/json writes text marshalers, like enums with names, as strings.
+	if valueType.Kind() != reflect.Pointer && valueType != timeType &&
+		valueType.Implements(textMarshalerType) {
+		return &Schema{Type: "string"}
+	}
+
+	switch valueType.Kind() {
+	case reflect.Pointer:
+		schema := document.schemaFor(valueType.Elem())
+		if schema.Type != nil {
+			schema.Type = []any{schema.Type, "null"}
+		}
+
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: document.schemaFor(valueType.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: document.schemaFor(valueType.Elem())}
+	case reflect.Struct:
+		if valueType == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+
+		return document.structSchema(valueType)
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchema follows encoding/json: unexported and "-" fields are skipped,
+// pointers and omitempty fields are optional and the rest are required.
+func (document *Document) structSchema(valueType reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := range valueType.NumField() {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = document.schemaFor(field.Type)
+
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+// Diff returns the routes that have no operation in the document and the
+// operations that have no route, both as "METHOD /path".
+func (document *Document) Diff(routes []*echo.Route) ([]string, []string) {
+	registered := map[string]bool{}
+
+	for _, route := range routes {
+		if route.Method == echo.RouteNotFound {
+			continue
+		}
+
+		registered[route.Method+" "+openAPIPath(route.Path)] = true
+	}
+
+	documented := map[string]bool{}
+
+	for path, item := range document.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	return difference(registered, documented), difference(documented, registered)
+}
+
+func difference(from, subtract map[string]bool) []string {
+	result := []string{}
+
+	for key := range from {
+		if !subtract[key] {
+			result = append(result, key)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// openAPIPath turns echo's "/task/:id" into "/task/{id}". The trailing "*" of
+// a static route becomes a "{path}" parameter.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+
+	path = strings.Join(segments, "/")
+
+	if strings.HasSuffix(path, "*") {
+		path = strings.TrimSuffix(path, "*") + "{path}"
+	}
+
+	return path
+}
+
+func pathParams(path string) []string {
+	params := []string{}
+
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params = append(params, segment[1:len(segment)-1])
+		}
+	}
+
+	return params
+}
+
+// HTMLResponse describes a page or an htmx fragment.
+func HTMLResponse(description string) Response {
+	return Response{
+		Description: description,
+		Content:     map[string]MediaType{echo.MIMETextHTML: {Schema: &Schema{Type: "string"}}},
+	}
+}
+
+func JSONResponse(description string, schema *Schema) Response {
+	return Response{
+		Description: description,
+		Content:     map[string]MediaType{echo.MIMEApplicationJSON: {Schema: schema}},
+	}
+}
+
+func JSONBody(schema *Schema) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]MediaType{echo.MIMEApplicationJSON: {Schema: schema}},
+	}
+}
+
+// FormBody describes a url encoded form with string fields.
+func FormBody(fields ...string) *RequestBody {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for _, field := range fields {
+		schema.Properties[field] = &Schema{Type: "string"}
+	}
+
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]MediaType{echo.MIMEApplicationForm: {Schema: schema}},
+	}
+}